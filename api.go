@@ -17,56 +17,71 @@ import (
 
 func Create[T any](ctx context.Context, engine *Engine, object T,
 	nsId ...uint64) (uint64, T, error) {
-	engine.mutex.Lock()
-	defer engine.mutex.Unlock()
+	engine.mutex.RLock()
+	defer engine.mutex.RUnlock()
 	if len(nsId) > 1 {
 		return 0, object, fmt.Errorf("only one namespace is allowed")
 	}
-	ctx, ns, err := getDefaultNamespace(ctx, engine, nsId...)
+	ctx, txn, finish, err := getDefaultTxn(ctx, engine, false, nsId...)
 	if err != nil {
 		return 0, object, err
 	}
 
-	gid, err := engine.z.nextUID()
+	gid, object, err := create(ctx, txn, object)
+	if err := finish(err); err != nil {
+		return 0, object, err
+	}
+	return gid, object, nil
+}
+
+func create[T any](ctx context.Context, txn *Txn, object T) (uint64, T, error) {
+	gid, err := txn.ns.engine.z.nextUID()
 	if err != nil {
 		return 0, object, err
 	}
 
 	dms := make([]*dql.Mutation, 0)
 	sch := &schema.ParsedSchema{}
-	err = generateSetDqlMutationsAndSchema[T](ctx, ns, object, gid, &dms, sch)
+	err = generateSetDqlMutationsAndSchema[T](ctx, txn, object, gid, &dms, sch)
 	if err != nil {
 		return 0, object, err
 	}
 
-	err = engine.alterSchemaWithParsed(ctx, sch)
+	err = txn.ns.engine.alterSchemaWithParsed(ctx, sch)
 	if err != nil {
 		return 0, object, err
 	}
 
-	err = applyDqlMutations(ctx, engine, dms)
+	err = txn.mutateWithDqlMutation(ctx, dms, nil)
 	if err != nil {
 		return 0, object, err
 	}
 
-	return getByGid[T](ctx, ns, gid)
+	return getByGid[T](ctx, txn, gid)
 }
 
 func Upsert[T any](ctx context.Context, engine *Engine, object T,
 	nsId ...uint64) (uint64, T, bool, error) {
-
-	var wasFound bool
-	engine.mutex.Lock()
-	defer engine.mutex.Unlock()
+	engine.mutex.RLock()
+	defer engine.mutex.RUnlock()
 	if len(nsId) > 1 {
 		return 0, object, false, fmt.Errorf("only one namespace is allowed")
 	}
 
-	ctx, ns, err := getDefaultNamespace(ctx, engine, nsId...)
+	ctx, txn, finish, err := getDefaultTxn(ctx, engine, false, nsId...)
 	if err != nil {
 		return 0, object, false, err
 	}
 
+	gid, object, wasFound, err := upsert(ctx, txn, object)
+	if err := finish(err); err != nil {
+		return 0, object, false, err
+	}
+	return gid, object, wasFound, nil
+}
+
+func upsert[T any](ctx context.Context, txn *Txn, object T) (uint64, T, bool, error) {
+	var wasFound bool
 	gid, cfKeyValue, err := structreflect.GetUniqueConstraint[T](object)
 	if err != nil {
 		return 0, object, false, err
@@ -81,18 +96,18 @@ func Upsert[T any](ctx context.Context, engine *Engine, object T,
 
 	dms := make([]*dql.Mutation, 0)
 	sch := &schema.ParsedSchema{}
-	err = generateSetDqlMutationsAndSchema[T](ctx, ns, object, gid, &dms, sch)
+	err = generateSetDqlMutationsAndSchema[T](ctx, txn, object, gid, &dms, sch)
 	if err != nil {
 		return 0, object, false, err
 	}
 
-	err = ns.engine.alterSchemaWithParsed(ctx, sch)
+	err = txn.ns.engine.alterSchemaWithParsed(ctx, sch)
 	if err != nil {
 		return 0, object, false, err
 	}
 
 	if gid != 0 || cf != nil {
-		gid, err = getExistingObject[T](ctx, ns, gid, cf, object)
+		gid, err = getExistingObject[T](ctx, txn, gid, cf, object)
 		if err != nil && err != apiutils.ErrNoObjFound {
 			return 0, object, false, err
 		}
@@ -100,24 +115,24 @@ func Upsert[T any](ctx context.Context, engine *Engine, object T,
 	}
 
 	if gid == 0 {
-		gid, err = engine.z.nextUID()
+		gid, err = txn.ns.engine.z.nextUID()
 		if err != nil {
 			return 0, object, false, err
 		}
 	}
 
 	dms = make([]*dql.Mutation, 0)
-	err = generateSetDqlMutationsAndSchema[T](ctx, ns, object, gid, &dms, sch)
+	err = generateSetDqlMutationsAndSchema[T](ctx, txn, object, gid, &dms, sch)
 	if err != nil {
 		return 0, object, false, err
 	}
 
-	err = applyDqlMutations(ctx, engine, dms)
+	err = txn.mutateWithDqlMutation(ctx, dms, nil)
 	if err != nil {
 		return 0, object, false, err
 	}
 
-	gid, object, err = getByGid[T](ctx, ns, gid)
+	gid, object, err = getByGid[T](ctx, txn, gid)
 	if err != nil {
 		return 0, object, false, err
 	}
@@ -127,63 +142,200 @@ func Upsert[T any](ctx context.Context, engine *Engine, object T,
 
 func Get[T any, R UniqueField](ctx context.Context, engine *Engine, uniqueField R,
 	nsId ...uint64) (uint64, T, error) {
-	engine.mutex.Lock()
-	defer engine.mutex.Unlock()
+	engine.mutex.RLock()
+	defer engine.mutex.RUnlock()
 	var obj T
 	if len(nsId) > 1 {
 		return 0, obj, fmt.Errorf("only one namespace is allowed")
 	}
-	ctx, ns, err := getDefaultNamespace(ctx, engine, nsId...)
+	ctx, txn, finish, err := getDefaultTxn(ctx, engine, true, nsId...)
 	if err != nil {
 		return 0, obj, err
 	}
+
+	gid, obj, err := get[T](ctx, txn, uniqueField)
+	if err := finish(err); err != nil {
+		return 0, obj, err
+	}
+	return gid, obj, nil
+}
+
+func get[T any, R UniqueField](ctx context.Context, txn *Txn, uniqueField R) (uint64, T, error) {
 	if uid, ok := any(uniqueField).(uint64); ok {
-		return getByGid[T](ctx, ns, uid)
+		return getByGid[T](ctx, txn, uid)
 	}
 
 	if cf, ok := any(uniqueField).(ConstrainedField); ok {
-		return getByConstrainedField[T](ctx, ns, cf)
+		return getByConstrainedField[T](ctx, txn, cf)
 	}
 
+	var obj T
 	return 0, obj, fmt.Errorf("invalid unique field type")
 }
 
 func Query[T any](ctx context.Context, engine *Engine, queryParams QueryParams,
 	nsId ...uint64) ([]uint64, []T, error) {
-	engine.mutex.Lock()
-	defer engine.mutex.Unlock()
+	engine.mutex.RLock()
+	defer engine.mutex.RUnlock()
 	if len(nsId) > 1 {
 		return nil, nil, fmt.Errorf("only one namespace is allowed")
 	}
-	ctx, ns, err := getDefaultNamespace(ctx, engine, nsId...)
+	ctx, txn, finish, err := getDefaultTxn(ctx, engine, true, nsId...)
 	if err != nil {
 		return nil, nil, err
 	}
 
-	return executeQuery[T](ctx, ns, queryParams, true)
+	uids, objs, err := executeQuery[T](ctx, txn, queryParams, true, nil)
+	if err := finish(err); err != nil {
+		return nil, nil, err
+	}
+	return uids, objs, nil
+}
+
+// QueryPage returns a page of the objects of type T selected by the query parameters,
+// with the total number of objects and the cursor of the next page. The next page is
+// fetched with the same parameters and NextCursor set as Pagination.Cursor, which
+// follows the sorting rather than an offset, so that the pages stay in step as objects
+// are added and deleted. The objects sharing the values of the sort fields are returned
+// in the order of their gids. Objects without a value of a sort field are not returned
+// after the first page, they should be filtered out when sorting on an optional field.
+func QueryPage[T any](ctx context.Context, engine *Engine, queryParams QueryParams,
+	nsId ...uint64) (*Page[T], error) {
+	engine.mutex.RLock()
+	defer engine.mutex.RUnlock()
+	if len(nsId) > 1 {
+		return nil, fmt.Errorf("only one namespace is allowed")
+	}
+	ctx, txn, finish, err := getDefaultTxn(ctx, engine, true, nsId...)
+	if err != nil {
+		return nil, err
+	}
+
+	page, err := executeQueryPage[T](ctx, txn, queryParams)
+	if err := finish(err); err != nil {
+		return nil, err
+	}
+	return page, nil
+}
+
+// Count returns the number of objects of type T selected by the query parameters, the
+// Sorting has no effect.
+func Count[T any](ctx context.Context, engine *Engine, queryParams QueryParams,
+	nsId ...uint64) (int64, error) {
+	engine.mutex.RLock()
+	defer engine.mutex.RUnlock()
+	if len(nsId) > 1 {
+		return 0, fmt.Errorf("only one namespace is allowed")
+	}
+	ctx, txn, finish, err := getDefaultTxn(ctx, engine, true, nsId...)
+	if err != nil {
+		return 0, err
+	}
+
+	count, err := executeCount[T](ctx, txn, queryParams)
+	if err := finish(err); err != nil {
+		return 0, err
+	}
+	return count, nil
+}
+
+// Aggregate counts the objects of type T matching the filter and aggregates the values
+// of a field, either for all of them or for every group of objects given by GroupBy.
+func Aggregate[T any](ctx context.Context, engine *Engine, params AggregateParams,
+	nsId ...uint64) ([]AggregateResult, error) {
+	engine.mutex.RLock()
+	defer engine.mutex.RUnlock()
+	if len(nsId) > 1 {
+		return nil, fmt.Errorf("only one namespace is allowed")
+	}
+	ctx, txn, finish, err := getDefaultTxn(ctx, engine, true, nsId...)
+	if err != nil {
+		return nil, err
+	}
+
+	aggs, err := executeAggregate[T](ctx, txn, params)
+	if err := finish(err); err != nil {
+		return nil, err
+	}
+	return aggs, nil
+}
+
+// VectorSearch returns the objects of type T with the vectors closest to a vector, closest
+// first, along with their distances.
+func VectorSearch[T any](ctx context.Context, engine *Engine, params VectorSearchParams,
+	nsId ...uint64) ([]SearchResult[T], error) {
+	engine.mutex.RLock()
+	defer engine.mutex.RUnlock()
+	if len(nsId) > 1 {
+		return nil, fmt.Errorf("only one namespace is allowed")
+	}
+	ctx, txn, finish, err := getDefaultTxn(ctx, engine, true, nsId...)
+	if err != nil {
+		return nil, err
+	}
+
+	results, err := executeVectorSearch[T](ctx, txn, params)
+	if err := finish(err); err != nil {
+		return nil, err
+	}
+	return results, nil
+}
+
+// HybridSearch returns the objects of type T most similar to a vector and matching the
+// terms of a text, merging the results of both searches into a single ranking. The
+// vector matches are scored by their distances with the metric of the vector index, and
+// the text matches by the share of the terms they match with the term or fulltext index
+// of the field.
+func HybridSearch[T any](ctx context.Context, engine *Engine, params HybridSearchParams,
+	nsId ...uint64) ([]SearchResult[T], error) {
+	engine.mutex.RLock()
+	defer engine.mutex.RUnlock()
+	if len(nsId) > 1 {
+		return nil, fmt.Errorf("only one namespace is allowed")
+	}
+	ctx, txn, finish, err := getDefaultTxn(ctx, engine, true, nsId...)
+	if err != nil {
+		return nil, err
+	}
+
+	results, err := executeHybridSearch[T](ctx, txn, params)
+	if err := finish(err); err != nil {
+		return nil, err
+	}
+	return results, nil
 }
 
 func Delete[T any, R UniqueField](ctx context.Context, engine *Engine, uniqueField R,
 	nsId ...uint64) (uint64, T, error) {
-	engine.mutex.Lock()
-	defer engine.mutex.Unlock()
+	engine.mutex.RLock()
+	defer engine.mutex.RUnlock()
 	var zeroObj T
 	if len(nsId) > 1 {
 		return 0, zeroObj, fmt.Errorf("only one namespace is allowed")
 	}
-	ctx, ns, err := getDefaultNamespace(ctx, engine, nsId...)
+	ctx, txn, finish, err := getDefaultTxn(ctx, engine, false, nsId...)
 	if err != nil {
 		return 0, zeroObj, err
 	}
+
+	uid, obj, err := deleteObj[T](ctx, txn, uniqueField)
+	if err := finish(err); err != nil {
+		return 0, zeroObj, err
+	}
+	return uid, obj, nil
+}
+
+func deleteObj[T any, R UniqueField](ctx context.Context, txn *Txn, uniqueField R) (uint64, T, error) {
+	var zeroObj T
 	if uid, ok := any(uniqueField).(uint64); ok {
-		uid, obj, err := getByGid[T](ctx, ns, uid)
+		uid, obj, err := getByGid[T](ctx, txn, uid)
 		if err != nil {
 			return 0, zeroObj, err
 		}
 
-		dms := generateDeleteDqlMutations(ns, uid)
+		dms := generateDeleteDqlMutations(txn.ns, uid)
 
-		err = applyDqlMutations(ctx, engine, dms)
+		err = txn.mutateWithDqlMutation(ctx, dms, nil)
 		if err != nil {
 			return 0, zeroObj, err
 		}
@@ -192,14 +344,14 @@ func Delete[T any, R UniqueField](ctx context.Context, engine *Engine, uniqueFie
 	}
 
 	if cf, ok := any(uniqueField).(ConstrainedField); ok {
-		uid, obj, err := getByConstrainedField[T](ctx, ns, cf)
+		uid, obj, err := getByConstrainedField[T](ctx, txn, cf)
 		if err != nil {
 			return 0, zeroObj, err
 		}
 
-		dms := generateDeleteDqlMutations(ns, uid)
+		dms := generateDeleteDqlMutations(txn.ns, uid)
 
-		err = applyDqlMutations(ctx, engine, dms)
+		err = txn.mutateWithDqlMutation(ctx, dms, nil)
 		if err != nil {
 			return 0, zeroObj, err
 		}
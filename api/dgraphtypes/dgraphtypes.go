@@ -18,7 +18,7 @@ import (
 	"github.com/twpayne/go-geom/encoding/wkb"
 )
 
-func addIndex(u *pb.SchemaUpdate, index string, uniqueConstraintExists bool) bool {
+func addIndex(u *pb.SchemaUpdate, index, metric string, uniqueConstraintExists bool) bool {
 	u.Directive = pb.SchemaUpdate_INDEX
 	switch index {
 	case "exact":
@@ -36,6 +36,8 @@ func addIndex(u *pb.SchemaUpdate, index string, uniqueConstraintExists bool) boo
 		u.Tokenizer = []string{"fulltext"}
 	case "trigram":
 		u.Tokenizer = []string{"trigram"}
+	case "geo":
+		u.Tokenizer = []string{"geo"}
 	case "vector":
 		u.IndexSpecs = []*pb.VectorIndexSpec{
 			{
@@ -43,7 +45,7 @@ func addIndex(u *pb.SchemaUpdate, index string, uniqueConstraintExists bool) boo
 				Options: []*pb.OptionPair{
 					{
 						Key:   "metric",
-						Value: "cosine",
+						Value: metric,
 					},
 				},
 			},
@@ -144,10 +146,24 @@ func HandleConstraints(u *pb.SchemaUpdate, jsonToDbTags map[string]*structreflec
 		return uniqueConstraintFound, nil
 	}
 
-	constraint := jsonToDbTags[jsonName].Constraint
+	dbTag := jsonToDbTags[jsonName]
+	constraint := dbTag.Constraint
 	if constraint == "vector" && valType != pb.Posting_VFLOAT {
 		return false, fmt.Errorf("vector index can only be applied to []float values")
 	}
+	if dbTag.Metric != "" {
+		if constraint != "vector" {
+			return false, fmt.Errorf("metric can only be set on a vector index")
+		}
+		switch dbTag.Metric {
+		case structreflect.MetricCosine, structreflect.MetricEuclidean, structreflect.MetricDotProduct:
+		default:
+			return false, fmt.Errorf("unknown vector index metric %s", dbTag.Metric)
+		}
+	}
+	if constraint == "geo" && valType != pb.Posting_GEO {
+		return false, fmt.Errorf("geo index can only be applied to geom.Point values")
+	}
 
-	return addIndex(u, constraint, uniqueConstraintFound), nil
+	return addIndex(u, constraint, dbTag.VectorMetric(), uniqueConstraintFound), nil
 }
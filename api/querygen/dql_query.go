@@ -7,8 +7,12 @@ package querygen
 
 import (
 	"fmt"
+	"math"
 	"strconv"
 	"strings"
+	"time"
+
+	"github.com/twpayne/go-geom"
 )
 
 type SchemaField struct {
@@ -31,38 +35,132 @@ const (
     {
       obj(func: %s) {
         gid: uid
-        expand(_all_) {
-            gid: uid
-            expand(_all_)
-            dgraph.type
-        }
-        dgraph.type
         %s
+        dgraph.type
       }
     }
     `
 
 	ObjsQuery = `
-    {
-      objs(func: type("%s")%s) @filter(%s) {
+    %s{
+      %s
+      objs(func: type("%s")%s) @filter(%s)%s {
         gid: uid
-        expand(_all_) {
+        %s
+        dgraph.type
+      }
+    }
+  `
+
+	EdgeQuery = `
+        %s%s%s%s {
             gid: uid
-            expand(_all_)
+            %s
             dgraph.type
         }
-        dgraph.type
+  `
+
+	CountQuery = `
+    %s{
+      %s
+      objs as var(func: type("%s")%s) @filter(%s)%s {
+        uid
         %s
       }
+      total(func: uid(objs)) {
+        count: count(uid)
+      }
     }
   `
 
-	ReverseEdgeQuery = `
-  %s: ~%s {
-			gid: uid
-			expand(_all_)
-			dgraph.type
-		}
+	AggregateQuery = `
+    {
+      objs as var(func: type("%s")) @filter(%s) {
+        uid
+        %s
+      }
+      total(func: uid(objs)) {
+        count: count(uid)
+      }
+      %s
+    }
+  `
+
+	AggregateValuesVar   = `vals as %s`
+	AggregateValuesQuery = `
+      aggs() {
+        min: min(val(vals))
+        max: max(val(vals))
+        sum: sum(val(vals))
+        avg: avg(val(vals))
+      }
+  `
+
+	GroupByQuery = `
+    {
+      objs(func: type("%s")) @filter(%s) @groupby(%s) {
+        count(uid)
+        %s
+      }
+    }
+  `
+
+	GroupByValuesQuery = `
+        min(%[1]s)
+        max(%[1]s)
+        sum(%[1]s)
+        avg(%[1]s)
+  `
+
+	SortVarQuery = `
+      var(func: type("%s")) {
+        %s
+      }
+  `
+	SortAggregateVar = `%s as %s(val(%s))`
+	VectorVar        = `%[1]s_vec as %[2]s`
+	// the distances of the vectors in the variable name_vec to the vector $name, the
+	// cosine one with the norm of the vector
+	DistanceCosine     = `%[1]s as math(1.0 - (%[1]s_vec dot $%[1]s) / (sqrt(%[1]s_vec dot %[1]s_vec) * %[2]s))`
+	DistanceEuclidean  = `%[1]s as math(sqrt((%[1]s_vec - $%[1]s) dot (%[1]s_vec - $%[1]s)))`
+	DistanceDotProduct = `%[1]s as math(0.0 - (%[1]s_vec dot $%[1]s))`
+	QueryVarsHeader    = `query q(%s) `
+	VectorQueryParam   = `$%s: float32vector`
+
+	VectorSearchQuery = `
+    %[1]s{
+      var(func: similar_to(%[2]s, %[3]d, $%[4]s))%[5]s {
+        %[6]s
+      }
+      objs(func: uid(%[4]s), orderasc: val(%[4]s))%[7]s {
+        gid: uid
+        distance: val(%[4]s)
+        %[8]s
+        dgraph.type
+      }
+    }
+  `
+
+	// the objects matching the term, with their number of values of the attribute, which
+	// is capped to 1 in the score so that lists count once
+	TermMatchVar = `
+      %[1]s as var(func: type("%[2]s"))%[3]s {
+        %[1]s_n as count(%[4]s)
+      }
+  `
+	TermSearchQuery = `
+    {
+      %[1]s
+      var(func: uid(%[2]s)) {
+        %[3]s as math((%[4]s) / %[5]d.0)
+      }
+      objs(func: uid(%[3]s), orderdesc: val(%[3]s), first: %[6]d) {
+        gid: uid
+        score: val(%[3]s)
+        %[7]s
+        dgraph.type
+      }
+    }
   `
 
 	SchemaQuery = `
@@ -81,6 +179,14 @@ const (
 	FuncGe         = `ge(%s, %s)`
 	FuncGt         = `gt(%s, %s)`
 	FuncLt         = `lt(%s, %s)`
+	FuncNear       = `near(%s, %s, %s)`
+	FuncWithin     = `within(%s, %s)`
+	FuncContains   = `contains(%s, %s)`
+	FuncIntersects = `intersects(%s, %s)`
+
+	DirectiveFilter        = ` @filter(%s)`
+	DirectiveCascade       = ` @cascade`
+	DirectiveCascadeFields = ` @cascade(%s)`
 )
 
 func BuildUidQuery(gid uint64) QueryFunc {
@@ -95,6 +201,99 @@ func BuildEqQuery(key string, value any) QueryFunc {
 	}
 }
 
+// BuildValueQuery returns the function with the given format, such as FuncGt, applied
+// to the attribute and the value, formatted as a DQL literal of its type.
+func BuildValueQuery(funcFormat, attr string, value any) QueryFunc {
+	return func() string {
+		return fmt.Sprintf(funcFormat, attr, FormatValue(value))
+	}
+}
+
+// FormatValue returns the value as a DQL literal, datetimes are quoted in RFC 3339 format.
+func FormatValue(value any) string {
+	switch v := value.(type) {
+	case int64:
+		return strconv.FormatInt(v, 10)
+	case float64:
+		return strconv.FormatFloat(v, 'f', -1, 64)
+	case bool:
+		return strconv.FormatBool(v)
+	case time.Time:
+		return strconv.Quote(v.Format(time.RFC3339Nano))
+	case string:
+		return strconv.Quote(v)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+// BuildNearQuery selects the geometries within distance meters of the point.
+func BuildNearQuery(attr string, point *geom.Point, distance float64) QueryFunc {
+	return func() string {
+		return fmt.Sprintf(FuncNear, attr, FormatGeometry(point), strconv.FormatFloat(distance, 'f', -1, 64))
+	}
+}
+
+// BuildWithinQuery selects the geometries within the polygon or multipolygon.
+func BuildWithinQuery(attr string, area geom.T) QueryFunc {
+	return func() string {
+		return fmt.Sprintf(FuncWithin, attr, FormatGeometry(area))
+	}
+}
+
+// BuildContainsQuery selects the polygons containing the point or polygon.
+func BuildContainsQuery(attr string, g geom.T) QueryFunc {
+	return func() string {
+		return fmt.Sprintf(FuncContains, attr, FormatGeometry(g))
+	}
+}
+
+// BuildIntersectsQuery selects the polygons intersecting the polygon or multipolygon.
+func BuildIntersectsQuery(attr string, area geom.T) QueryFunc {
+	return func() string {
+		return fmt.Sprintf(FuncIntersects, attr, FormatGeometry(area))
+	}
+}
+
+// FormatGeometry returns the coordinates of a point, polygon or multipolygon as a DQL
+// literal, e.g. [[[1, 2], [3, 4], [5, 6], [1, 2]]] for a polygon. Other geometries are
+// formatted as an empty list, rejected by the query parser.
+func FormatGeometry(g geom.T) string {
+	formatCoord := func(c geom.Coord) string {
+		return fmt.Sprintf("[%s, %s]", strconv.FormatFloat(c.X(), 'f', -1, 64),
+			strconv.FormatFloat(c.Y(), 'f', -1, 64))
+	}
+	formatRing := func(ring []geom.Coord) string {
+		coords := make([]string, len(ring))
+		for i, c := range ring {
+			coords[i] = formatCoord(c)
+		}
+		return "[" + strings.Join(coords, ", ") + "]"
+	}
+	formatPolygon := func(rings [][]geom.Coord) string {
+		polygon := make([]string, len(rings))
+		for i, ring := range rings {
+			polygon[i] = formatRing(ring)
+		}
+		return "[" + strings.Join(polygon, ", ") + "]"
+	}
+
+	switch g := g.(type) {
+	case *geom.Point:
+		return formatCoord(g.Coords())
+	case *geom.Polygon:
+		return formatPolygon(g.Coords())
+	case *geom.MultiPolygon:
+		polygons := make([]string, 0, g.NumPolygons())
+		for _, rings := range g.Coords() {
+			polygons = append(polygons, formatPolygon(rings))
+		}
+		return "[" + strings.Join(polygons, ", ") + "]"
+	default:
+		return "[]"
+	}
+}
+
 func BuildSimilarToQuery(indexAttr string, topK int64, vec []float32) QueryFunc {
 	vecStrArr := make([]string, len(vec))
 	for i := range vec {
@@ -160,36 +359,224 @@ func BuildLtQuery(attr, value string) QueryFunc {
 	}
 }
 
+// And joins the queries with AND, the empty queries are left out. The result is
+// wrapped in parentheses when more than one query is joined.
 func And(qfs ...QueryFunc) QueryFunc {
 	return func() string {
-		qs := make([]string, len(qfs))
-		for i, qf := range qfs {
-			qs[i] = qf()
-		}
-		return strings.Join(qs, " AND ")
+		return join(qfs, " AND ")
 	}
 }
 
+// Or joins the queries with OR, the same way as And.
 func Or(qfs ...QueryFunc) QueryFunc {
 	return func() string {
-		qs := make([]string, len(qfs))
-		for i, qf := range qfs {
-			qs[i] = qf()
-		}
-		return strings.Join(qs, " OR ")
+		return join(qfs, " OR ")
 	}
 }
 
 func Not(qf QueryFunc) QueryFunc {
 	return func() string {
-		return "NOT " + qf()
+		q := qf()
+		if q == "" {
+			return ""
+		}
+		return "NOT (" + q + ")"
 	}
 }
 
-func FormatObjQuery(qf QueryFunc, extraFields string) string {
-	return fmt.Sprintf(ObjQuery, qf(), extraFields)
+func join(qfs []QueryFunc, sep string) string {
+	qs := make([]string, 0, len(qfs))
+	for _, qf := range qfs {
+		if q := qf(); q != "" {
+			qs = append(qs, q)
+		}
+	}
+	if len(qs) == 1 {
+		return qs[0]
+	}
+	if len(qs) == 0 {
+		return ""
+	}
+	return "(" + strings.Join(qs, sep) + ")"
+}
+
+func FormatObjQuery(qf QueryFunc, fields string) string {
+	return fmt.Sprintf(ObjQuery, qf(), fields)
+}
+
+// QueryVars are the value variables computed by var blocks ahead of the main block of a
+// query, such as the values the objects are sorted by, with the query parameters used.
+type QueryVars struct {
+	Blocks []string
+	// Params are the declarations of the parameters, such as `$s: float32vector`, and
+	// Values their values keyed by name.
+	Params []string
+	Values map[string]string
+}
+
+func (vars *QueryVars) header() string {
+	if vars == nil || len(vars.Params) == 0 {
+		return ""
+	}
+	return fmt.Sprintf(QueryVarsHeader, strings.Join(vars.Params, ", "))
+}
+
+func (vars *QueryVars) blocks() string {
+	if vars == nil {
+		return ""
+	}
+	return strings.Join(vars.Blocks, "\n")
 }
 
-func FormatObjsQuery(typeName string, qf QueryFunc, paginationAndSorting string, extraFields string) string {
-	return fmt.Sprintf(ObjsQuery, typeName, paginationAndSorting, qf(), extraFields)
+// AddSortPath adds the variable with the values of the attribute reached through the
+// edges from the objects of the type. Each object gets the smallest value of its edges,
+// or the largest with the max aggregate.
+func (vars *QueryVars) AddSortPath(name, typeName string, edges []string, attr, aggregate string) {
+	// the values of the objects reached through edges[i:] are in the variable of level i
+	level := func(i int) string {
+		if i == 0 {
+			return name
+		}
+		return fmt.Sprintf("%s_%d", name, i)
+	}
+	block := fmt.Sprintf("%s as %s", level(len(edges)), attr)
+	for i := len(edges) - 1; i >= 0; i-- {
+		block = fmt.Sprintf("%s {\n%s\n}\n%s", edges[i], block,
+			fmt.Sprintf(SortAggregateVar, level(i), aggregate, level(i+1)))
+	}
+	vars.Blocks = append(vars.Blocks, fmt.Sprintf(SortVarQuery, typeName, block))
+}
+
+// AddSimilarity adds the variable with the distances of the vectors of the attribute of
+// the objects of the type to the vector, with the metric of the vector index.
+func (vars *QueryVars) AddSimilarity(name, typeName, attr, metric string, vec []float32) {
+	vars.addVectorParam(name, vec)
+	vars.Blocks = append(vars.Blocks, fmt.Sprintf(SortVarQuery, typeName,
+		FormatDistanceVar(name, attr, metric, vec)))
+}
+
+// addVectorParam adds the parameter with the vector, named after the variable.
+func (vars *QueryVars) addVectorParam(name string, vec []float32) {
+	vecStrArr := make([]string, len(vec))
+	for i := range vec {
+		vecStrArr[i] = strconv.FormatFloat(float64(vec[i]), 'f', -1, 32)
+	}
+	if vars.Values == nil {
+		vars.Values = make(map[string]string)
+	}
+	vars.Values["$"+name] = "[" + strings.Join(vecStrArr, ",") + "]"
+	vars.Params = append(vars.Params, fmt.Sprintf(VectorQueryParam, name))
+}
+
+// FormatDistanceVar returns the variable with the distances of the vectors of the
+// attribute to the vector parameter of the same name, with the metric of the vector
+// index: 1 - the cosine similarity for cosine, the euclidean distance for euclidean,
+// and the negated dot product for dotproduct, so that closer vectors are always at
+// smaller distances.
+func FormatDistanceVar(name, attr, metric string, vec []float32) string {
+	var distance string
+	switch metric {
+	case "euclidean":
+		distance = fmt.Sprintf(DistanceEuclidean, name)
+	case "dotproduct":
+		distance = fmt.Sprintf(DistanceDotProduct, name)
+	default:
+		var norm float64
+		for _, v := range vec {
+			norm += float64(v) * float64(v)
+		}
+		distance = fmt.Sprintf(DistanceCosine, name, strconv.FormatFloat(math.Sqrt(norm), 'f', -1, 64))
+	}
+	return fmt.Sprintf(VectorVar, name, attr) + "\n" + distance
+}
+
+// FormatVectorSearchQuery returns the query of the topK objects with the vectors of the
+// attribute closest to the vector, closest first, with their distances. The objects are
+// filtered by qf, and the ones farther than maxDistance, if set, are left out.
+func FormatVectorSearchQuery(name, attr, metric string, vec []float32, topK int64, qf QueryFunc,
+	maxDistance *float64, fields string, vars *QueryVars) string {
+	vars.addVectorParam(name, vec)
+	var filter, distanceFilter string
+	if f := qf(); f != "" {
+		filter = fmt.Sprintf(DirectiveFilter, f)
+	}
+	if maxDistance != nil {
+		distanceFilter = fmt.Sprintf(DirectiveFilter,
+			fmt.Sprintf(FuncLe, fmt.Sprintf("val(%s)", name), FormatValue(*maxDistance)))
+	}
+	return fmt.Sprintf(VectorSearchQuery, vars.header(), attr, topK, name, filter,
+		FormatDistanceVar(name, attr, metric, vec), distanceFilter, fields)
+}
+
+// FormatTermSearchQuery returns the query of the topK objects of the type matching the
+// most terms with the match function, BuildAnyOfTermsQuery or BuildAnyOfTextQuery, with
+// the share of the terms they match as their score, highest first. The objects are
+// filtered by qf.
+func FormatTermSearchQuery(name, typeName, attr string, terms []string,
+	match func(attr, terms string) QueryFunc, topK int64, qf QueryFunc, fields string) string {
+	blocks := make([]string, len(terms))
+	matches := make([]string, len(terms))
+	counts := make([]string, len(terms))
+	for i, term := range terms {
+		matches[i] = fmt.Sprintf("%s_%d", name, i)
+		counts[i] = fmt.Sprintf("min(%s_n, 1)", matches[i])
+		filter := And(match(attr, term), qf)
+		blocks[i] = fmt.Sprintf(TermMatchVar, matches[i], typeName,
+			fmt.Sprintf(DirectiveFilter, filter()), attr)
+	}
+	return fmt.Sprintf(TermSearchQuery, strings.Join(blocks, ""), strings.Join(matches, ", "), name,
+		strings.Join(counts, " + "), len(terms), topK, fields)
+}
+
+func FormatObjsQuery(typeName string, qf QueryFunc, paginationAndSorting, cascade, fields string,
+	vars *QueryVars) string {
+	return fmt.Sprintf(ObjsQuery, vars.header(), vars.blocks(), typeName, paginationAndSorting, qf(),
+		cascade, fields)
+}
+
+func FormatCountQuery(typeName string, qf QueryFunc, paginationAndSorting, cascade, fields string,
+	vars *QueryVars) string {
+	return fmt.Sprintf(CountQuery, vars.header(), vars.blocks(), typeName, paginationAndSorting, qf(),
+		cascade, fields)
+}
+
+// FormatAggregateQuery returns the query counting the objects of the type, along with
+// the aggregates of the values of the attribute if not empty.
+func FormatAggregateQuery(typeName string, qf QueryFunc, attr string) string {
+	if attr == "" {
+		return fmt.Sprintf(AggregateQuery, typeName, qf(), "", "")
+	}
+	return fmt.Sprintf(AggregateQuery, typeName, qf(), fmt.Sprintf(AggregateValuesVar, attr),
+		AggregateValuesQuery)
+}
+
+// FormatGroupByQuery returns the query counting the objects of the type in each group
+// of the values of groupBy, along with the aggregates of the values of the attribute
+// if not empty.
+func FormatGroupByQuery(typeName string, qf QueryFunc, groupBy []string, attr string) string {
+	var aggs string
+	if attr != "" {
+		aggs = fmt.Sprintf(GroupByValuesQuery, attr)
+	}
+	return fmt.Sprintf(GroupByQuery, typeName, qf(), strings.Join(groupBy, ", "), aggs)
+}
+
+// FormatEdgeQuery returns the block of an edge, pred can be an alias of a reverse
+// edge such as `alias: ~pred`. The filter is left out when qf is empty.
+func FormatEdgeQuery(pred string, qf QueryFunc, paginationAndSorting, cascade, fields string) string {
+	var filter string
+	if f := qf(); f != "" {
+		filter = fmt.Sprintf(DirectiveFilter, f)
+	}
+	if paginationAndSorting != "" {
+		paginationAndSorting = fmt.Sprintf(" (%s)", paginationAndSorting)
+	}
+	return fmt.Sprintf(EdgeQuery, pred, paginationAndSorting, filter, cascade, fields)
+}
+
+func FormatCascade(preds []string) string {
+	if len(preds) == 0 {
+		return DirectiveCascade
+	}
+	return fmt.Sprintf(DirectiveCascadeFields, strings.Join(preds, ", "))
 }
@@ -6,11 +6,20 @@
 package structreflect
 
 import (
+	"encoding/json"
 	"fmt"
 	"reflect"
 	"strconv"
+	"time"
 
 	"github.com/hypermodeinc/modusdb/api/apiutils"
+	"github.com/twpayne/go-geom"
+	"github.com/twpayne/go-geom/encoding/geojson"
+)
+
+var (
+	timeType  = reflect.TypeOf(time.Time{})
+	pointType = reflect.TypeOf(geom.Point{})
 )
 
 func GetFieldTags(t reflect.Type) (*TagMaps, error) {
@@ -43,48 +52,76 @@ func GetFieldTags(t reflect.Type) (*TagMaps, error) {
 	return tags, nil
 }
 
-func CreateDynamicStruct(t reflect.Type, fieldToJson map[string]string, depth int) reflect.Type {
+// EdgeType returns the type of the objects of a struct, pointer to struct or slice of
+// structs, nil for the types stored as values such as time.Time and geom.Point.
+func EdgeType(t reflect.Type) reflect.Type {
+	if t.Kind() == reflect.Ptr || t.Kind() == reflect.Slice {
+		t = t.Elem()
+	}
+	if t.Kind() != reflect.Struct || t == timeType || t == pointType {
+		return nil
+	}
+	return t
+}
+
+// CreateDynamicStruct returns the type used to decode the objects of type t along
+// with the objects of their edges, down to depth levels of edges. The nested types
+// are built once for every type and depth, so types referencing themselves, directly
+// or through other types, stop at the depth.
+func CreateDynamicStruct(t reflect.Type, fieldToJson map[string]string, depth int) (reflect.Type, error) {
+	return createDynamicStruct(t, fieldToJson, depth, make(map[dynamicStructKey]reflect.Type))
+}
+
+type dynamicStructKey struct {
+	t     reflect.Type
+	depth int
+}
+
+func createDynamicStruct(t reflect.Type, fieldToJson map[string]string, depth int,
+	built map[dynamicStructKey]reflect.Type) (reflect.Type, error) {
+
+	key := dynamicStructKey{t: t, depth: depth}
+	if dynamicType, ok := built[key]; ok {
+		return dynamicType, nil
+	}
+
 	fields := make([]reflect.StructField, 0, len(fieldToJson))
 	for fieldName, jsonName := range fieldToJson {
+		if fieldName == "Gid" {
+			continue
+		}
 		field, _ := t.FieldByName(fieldName)
-		if fieldName != "Gid" {
-			if field.Type.Kind() == reflect.Struct {
-				if depth <= 1 {
-					tagMaps, _ := GetFieldTags(field.Type)
-					nestedType := CreateDynamicStruct(field.Type, tagMaps.FieldToJson, depth+1)
-					fields = append(fields, reflect.StructField{
-						Name: field.Name,
-						Type: nestedType,
-						Tag:  reflect.StructTag(fmt.Sprintf(`json:"%s.%s"`, t.Name(), jsonName)),
-					})
-				}
-			} else if field.Type.Kind() == reflect.Ptr &&
-				field.Type.Elem().Kind() == reflect.Struct {
-				tagMaps, _ := GetFieldTags(field.Type.Elem())
-				nestedType := CreateDynamicStruct(field.Type.Elem(), tagMaps.FieldToJson, depth+1)
-				fields = append(fields, reflect.StructField{
-					Name: field.Name,
-					Type: reflect.PointerTo(nestedType),
-					Tag:  reflect.StructTag(fmt.Sprintf(`json:"%s.%s"`, t.Name(), jsonName)),
-				})
-			} else if field.Type.Kind() == reflect.Slice &&
-				field.Type.Elem().Kind() == reflect.Struct {
-				tagMaps, _ := GetFieldTags(field.Type.Elem())
-				nestedType := CreateDynamicStruct(field.Type.Elem(), tagMaps.FieldToJson, depth+1)
-				fields = append(fields, reflect.StructField{
-					Name: field.Name,
-					Type: reflect.SliceOf(nestedType),
-					Tag:  reflect.StructTag(fmt.Sprintf(`json:"%s.%s"`, t.Name(), jsonName)),
-				})
-			} else {
-				fields = append(fields, reflect.StructField{
-					Name: field.Name,
-					Type: field.Type,
-					Tag:  reflect.StructTag(fmt.Sprintf(`json:"%s.%s"`, t.Name(), jsonName)),
-				})
+		tag := reflect.StructTag(fmt.Sprintf(`json:"%s.%s"`, t.Name(), jsonName))
+
+		edgeType := EdgeType(field.Type)
+		if edgeType == nil {
+			fieldType := field.Type
+			// points are returned as GeoJSON, decoded by MapDynamicToFinal
+			if fieldType == pointType {
+				fieldType = reflect.TypeOf(json.RawMessage{})
 			}
+			fields = append(fields, reflect.StructField{Name: field.Name, Type: fieldType, Tag: tag})
+			continue
+		}
+		if depth <= 0 {
+			continue
+		}
 
+		tagMaps, err := GetFieldTags(edgeType)
+		if err != nil {
+			return nil, err
 		}
+		nestedType, err := createDynamicStruct(edgeType, tagMaps.FieldToJson, depth-1, built)
+		if err != nil {
+			return nil, err
+		}
+		switch field.Type.Kind() {
+		case reflect.Ptr:
+			nestedType = reflect.PointerTo(nestedType)
+		case reflect.Slice:
+			nestedType = reflect.SliceOf(nestedType)
+		}
+		fields = append(fields, reflect.StructField{Name: field.Name, Type: nestedType, Tag: tag})
 	}
 	fields = append(fields, reflect.StructField{
 		Name: "Gid",
@@ -95,7 +132,10 @@ func CreateDynamicStruct(t reflect.Type, fieldToJson map[string]string, depth in
 		Type: reflect.TypeOf([]string{}),
 		Tag:  reflect.StructTag(`json:"dgraph.type"`),
 	})
-	return reflect.StructOf(fields)
+
+	dynamicType := reflect.StructOf(fields)
+	built[key] = dynamicType
+	return dynamicType, nil
 }
 
 func MapDynamicToFinal(dynamic any, final any, isNested bool) (uint64, error) {
@@ -132,20 +172,23 @@ func MapDynamicToFinal(dynamic any, final any, isNested bool) (uint64, error) {
 		} else {
 			finalField = vFinal.FieldByName(dynamicField.Name)
 		}
-		if dynamicFieldType.Kind() == reflect.Struct {
+		isEdge := EdgeType(dynamicFieldType) != nil
+		if isEdge && dynamicFieldType.Kind() == reflect.Struct {
 			_, err := MapDynamicToFinal(dynamicValue.Addr().Interface(), finalField.Addr().Interface(), true)
 			if err != nil {
 				return 0, err
 			}
-		} else if dynamicFieldType.Kind() == reflect.Ptr &&
-			dynamicFieldType.Elem().Kind() == reflect.Struct {
-			// if field is a pointer, find if the underlying is a struct
+		} else if isEdge && dynamicFieldType.Kind() == reflect.Ptr {
+			// the pointer is left nil when the edge has no object
+			if dynamicValue.IsNil() {
+				continue
+			}
+			finalField.Set(reflect.New(finalField.Type().Elem()))
 			_, err := MapDynamicToFinal(dynamicValue.Interface(), finalField.Interface(), true)
 			if err != nil {
 				return 0, err
 			}
-		} else if dynamicFieldType.Kind() == reflect.Slice &&
-			dynamicFieldType.Elem().Kind() == reflect.Struct {
+		} else if isEdge && dynamicFieldType.Kind() == reflect.Slice {
 			for j := 0; j < dynamicValue.Len(); j++ {
 				sliceElem := dynamicValue.Index(j).Addr().Interface()
 				finalSliceElem := reflect.New(finalField.Type().Elem()).Elem()
@@ -160,6 +203,10 @@ func MapDynamicToFinal(dynamic any, final any, isNested bool) (uint64, error) {
 				// if field name is gid, convert it to uint64
 				if dynamicField.Name == "Gid" {
 					finalField.SetUint(gid)
+				} else if finalField.Type() == pointType {
+					if err := setPoint(finalField, dynamicValue.Bytes()); err != nil {
+						return 0, err
+					}
 				} else {
 					finalField.Set(dynamicValue)
 				}
@@ -169,6 +216,23 @@ func MapDynamicToFinal(dynamic any, final any, isNested bool) (uint64, error) {
 	return gid, nil
 }
 
+// setPoint decodes the GeoJSON of a point into the field.
+func setPoint(field reflect.Value, data []byte) error {
+	if len(data) == 0 {
+		return nil
+	}
+	var g geom.T
+	if err := geojson.Unmarshal(data, &g); err != nil {
+		return fmt.Errorf("error decoding point: %w", err)
+	}
+	p, ok := g.(*geom.Point)
+	if !ok {
+		return fmt.Errorf("expected a point, got %T", g)
+	}
+	field.Set(reflect.ValueOf(*p))
+	return nil
+}
+
 func ConvertDynamicToTyped[T any](obj any, t reflect.Type) (uint64, T, error) {
 	var result T
 	finalObject := reflect.New(t).Interface()
@@ -33,6 +33,8 @@ func parseDbTag(field reflect.StructField) *DbTag {
 		split := strings.Split(tag, "=")
 		if split[0] == "constraint" {
 			dbTag.Constraint = split[1]
+		} else if split[0] == "metric" && len(split) > 1 {
+			dbTag.Metric = split[1]
 		}
 	}
 	return dbTag
@@ -5,8 +5,25 @@
 
 package structreflect
 
+// The metrics of vector indexes, set with the metric key of db tags.
+const (
+	MetricCosine     = "cosine"
+	MetricEuclidean  = "euclidean"
+	MetricDotProduct = "dotproduct"
+)
+
 type DbTag struct {
 	Constraint string
+	// Metric is the metric of a vector index, cosine when empty.
+	Metric string
+}
+
+// VectorMetric returns the metric of the vector index of the tag.
+func (t *DbTag) VectorMetric() string {
+	if t.Metric == "" {
+		return MetricCosine
+	}
+	return t.Metric
 }
 
 type TagMaps struct {
@@ -22,7 +22,7 @@ import (
 	"github.com/hypermodeinc/modusdb/api/structreflect"
 )
 
-func generateSetDqlMutationsAndSchema[T any](ctx context.Context, n *Namespace, object T,
+func generateSetDqlMutationsAndSchema[T any](ctx context.Context, txn *Txn, object T,
 	gid uint64, dms *[]*dql.Mutation, sch *schema.ParsedSchema) error {
 	t := reflect.TypeOf(object)
 	if t.Kind() != reflect.Struct {
@@ -45,7 +45,7 @@ func generateSetDqlMutationsAndSchema[T any](ctx context.Context, n *Namespace,
 		if tagMaps.JsonToReverseEdge[jsonName] != "" {
 			reverseEdgeStr := tagMaps.JsonToReverseEdge[jsonName]
 			typeName := strings.Split(reverseEdgeStr, ".")[0]
-			currSchema, err := getSchema(ctx, n)
+			currSchema, err := getSchema(ctx, txn)
 			if err != nil {
 				return err
 			}
@@ -66,7 +66,7 @@ func generateSetDqlMutationsAndSchema[T any](ctx context.Context, n *Namespace,
 			}
 
 			if !(typeFound && predicateFound) {
-				if err := mutations.HandleReverseEdge(jsonName, reflectValueType, n.ID(), sch,
+				if err := mutations.HandleReverseEdge(jsonName, reflectValueType, txn.ns.ID(), sch,
 					reverseEdgeStr); err != nil {
 					return err
 				}
@@ -78,17 +78,17 @@ func generateSetDqlMutationsAndSchema[T any](ctx context.Context, n *Namespace,
 			continue
 		}
 
-		value, err = processStructValue(ctx, value, n)
+		value, err = processStructValue(ctx, value, txn)
 		if err != nil {
 			return err
 		}
 
-		value, err = processPointerValue(ctx, value, n)
+		value, err = processPointerValue(ctx, value, txn)
 		if err != nil {
 			return err
 		}
 
-		nquad, u, err := mutations.CreateNQuadAndSchema(value, gid, jsonName, t, n.ID())
+		nquad, u, err := mutations.CreateNQuadAndSchema(value, gid, jsonName, t, txn.ns.ID())
 		if err != nil {
 			return err
 		}
@@ -107,7 +107,7 @@ func generateSetDqlMutationsAndSchema[T any](ctx context.Context, n *Namespace,
 	}
 
 	sch.Types = append(sch.Types, &pb.TypeUpdate{
-		TypeName: apiutils.AddNamespace(n.ID(), t.Name()),
+		TypeName: apiutils.AddNamespace(txn.ns.ID(), t.Name()),
 		Fields:   sch.Preds,
 	})
 
@@ -116,7 +116,7 @@ func generateSetDqlMutationsAndSchema[T any](ctx context.Context, n *Namespace,
 		return err
 	}
 	typeNquad := &api.NQuad{
-		Namespace:   n.ID(),
+		Namespace:   txn.ns.ID(),
 		Subject:     fmt.Sprint(gid),
 		Predicate:   "dgraph.type",
 		ObjectValue: val,
@@ -7,22 +7,19 @@ package modusdb
 
 import (
 	"context"
-	"fmt"
 	"reflect"
 
 	"github.com/hypermodeinc/dgraph/v24/dql"
-	"github.com/hypermodeinc/dgraph/v24/protos/pb"
-	"github.com/hypermodeinc/dgraph/v24/query"
 	"github.com/hypermodeinc/dgraph/v24/schema"
-	"github.com/hypermodeinc/dgraph/v24/worker"
 	"github.com/hypermodeinc/modusdb/api/apiutils"
 	"github.com/hypermodeinc/modusdb/api/structreflect"
 )
 
-func processStructValue(ctx context.Context, value any, ns *Namespace) (any, error) {
-	if reflect.TypeOf(value).Kind() == reflect.Struct {
+func processStructValue(ctx context.Context, value any, txn *Txn) (any, error) {
+	// time.Time is stored as a value, not as a nested object
+	if structreflect.EdgeType(reflect.TypeOf(value)) != nil && reflect.TypeOf(value).Kind() == reflect.Struct {
 		value = reflect.ValueOf(value).Interface()
-		newGid, err := getUidOrMutate(ctx, ns.engine, ns, value)
+		newGid, err := getUidOrMutate(ctx, txn, value)
 		if err != nil {
 			return nil, err
 		}
@@ -31,19 +28,19 @@ func processStructValue(ctx context.Context, value any, ns *Namespace) (any, err
 	return value, nil
 }
 
-func processPointerValue(ctx context.Context, value any, ns *Namespace) (any, error) {
+func processPointerValue(ctx context.Context, value any, txn *Txn) (any, error) {
 	reflectValueType := reflect.TypeOf(value)
 	if reflectValueType.Kind() == reflect.Pointer {
 		reflectValueType = reflectValueType.Elem()
 		if reflectValueType.Kind() == reflect.Struct {
 			value = reflect.ValueOf(value).Elem().Interface()
-			return processStructValue(ctx, value, ns)
+			return processStructValue(ctx, value, txn)
 		}
 	}
 	return value, nil
 }
 
-func getUidOrMutate[T any](ctx context.Context, engine *Engine, ns *Namespace, object T) (uint64, error) {
+func getUidOrMutate[T any](ctx context.Context, txn *Txn, object T) (uint64, error) {
 	gid, cfKeyValue, err := structreflect.GetUniqueConstraint[T](object)
 	if err != nil {
 		return 0, err
@@ -55,17 +52,17 @@ func getUidOrMutate[T any](ctx context.Context, engine *Engine, ns *Namespace, o
 
 	dms := make([]*dql.Mutation, 0)
 	sch := &schema.ParsedSchema{}
-	err = generateSetDqlMutationsAndSchema(ctx, ns, object, gid, &dms, sch)
+	err = generateSetDqlMutationsAndSchema(ctx, txn, object, gid, &dms, sch)
 	if err != nil {
 		return 0, err
 	}
 
-	err = engine.alterSchemaWithParsed(ctx, sch)
+	err = txn.ns.engine.alterSchemaWithParsed(ctx, sch)
 	if err != nil {
 		return 0, err
 	}
 	if gid != 0 || cf != nil {
-		gid, err = getExistingObject(ctx, ns, gid, cf, object)
+		gid, err = getExistingObject(ctx, txn, gid, cf, object)
 		if err != nil && err != apiutils.ErrNoObjFound {
 			return 0, err
 		}
@@ -74,60 +71,20 @@ func getUidOrMutate[T any](ctx context.Context, engine *Engine, ns *Namespace, o
 		}
 	}
 
-	gid, err = engine.z.nextUID()
+	gid, err = txn.ns.engine.z.nextUID()
 	if err != nil {
 		return 0, err
 	}
 
 	dms = make([]*dql.Mutation, 0)
-	err = generateSetDqlMutationsAndSchema(ctx, ns, object, gid, &dms, sch)
+	err = generateSetDqlMutationsAndSchema(ctx, txn, object, gid, &dms, sch)
 	if err != nil {
 		return 0, err
 	}
 
-	err = applyDqlMutations(ctx, engine, dms)
-	if err != nil {
+	if err := txn.mutateWithDqlMutation(ctx, dms, nil); err != nil {
 		return 0, err
 	}
 
 	return gid, nil
 }
-
-func applyDqlMutations(ctx context.Context, engine *Engine, dms []*dql.Mutation) error {
-	edges, err := query.ToDirectedEdges(dms, nil)
-	if err != nil {
-		return err
-	}
-
-	if !engine.isOpen.Load() {
-		return ErrClosedEngine
-	}
-
-	startTs, err := engine.z.nextTs()
-	if err != nil {
-		return err
-	}
-	commitTs, err := engine.z.nextTs()
-	if err != nil {
-		return err
-	}
-
-	m := &pb.Mutations{
-		GroupId: 1,
-		StartTs: startTs,
-		Edges:   edges,
-	}
-	m.Edges, err = query.ExpandEdges(ctx, m)
-	if err != nil {
-		return fmt.Errorf("error expanding edges: %w", err)
-	}
-
-	p := &pb.Proposal{Mutations: m, StartTs: startTs}
-	if err := worker.ApplyMutations(ctx, p); err != nil {
-		return err
-	}
-
-	return worker.ApplyCommited(ctx, &pb.OracleDelta{
-		Txns: []*pb.TxnStatus{{StartTs: startTs, CommitTs: commitTs}},
-	})
-}
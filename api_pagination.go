@@ -0,0 +1,313 @@
+/*
+ * SPDX-FileCopyrightText: © Hypermode Inc. <hello@hypermode.com>
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package modusdb
+
+import (
+	"bytes"
+	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"reflect"
+	"strconv"
+	"strings"
+
+	"github.com/hypermodeinc/modusdb/api/apiutils"
+	"github.com/hypermodeinc/modusdb/api/querygen"
+)
+
+// ErrInvalidCursor is returned for a Pagination.Cursor that was not returned by QueryPage
+// for the same type and sorting.
+var ErrInvalidCursor = errors.New("invalid pagination cursor")
+
+// Page is a page of the objects of a query, returned by QueryPage.
+type Page[T any] struct {
+	Gids []uint64
+	Objs []T
+	// Total is the number of objects matching the query parameters over all the pages.
+	Total   int64
+	HasNext bool
+	// NextCursor is the Pagination.Cursor of the next page, it is empty on the last page.
+	NextCursor string
+}
+
+// pageCursor is the position of a page in the objects of a query. It has the values of
+// the sort fields of the last object of the page and its gid, the objects sharing the
+// values being paged in the order of their gids. Without sorting, it only has the gid.
+type pageCursor struct {
+	Sort   string `json:"s"`
+	Values []any  `json:"v,omitempty"`
+	Gid    uint64 `json:"g"`
+}
+
+// cursorField is a field the objects are sorted by, in the order of the query.
+type cursorField struct {
+	field reflect.StructField
+	pred  string
+	desc  bool
+}
+
+// cursorFields returns the fields of the type in the sorting, in the order they are
+// applied. Cursors only follow the fields of the type, not paths of edges or similarities.
+func cursorFields(t reflect.Type, s *Sorting) ([]cursorField, error) {
+	if s == nil {
+		return nil, nil
+	}
+	keys, err := s.sortKeys()
+	if err != nil {
+		return nil, err
+	}
+
+	fields := make([]cursorField, len(keys))
+	for i, key := range keys {
+		if key.SimilarTo != nil || strings.Contains(key.Field, ".") {
+			return nil, fmt.Errorf("pages can only be sorted by the fields of type %s", t.Name())
+		}
+		field, err := sortField(t, key.Field)
+		if err != nil {
+			return nil, err
+		}
+		fields[i] = cursorField{
+			field: field,
+			pred:  apiutils.GetPredicateName(t.Name(), key.Field),
+			desc:  key.Desc,
+		}
+	}
+	return fields, nil
+}
+
+// sortKey identifies the type and sorting a cursor is valid for.
+func sortKey(t reflect.Type, fields []cursorField) string {
+	parts := []string{t.Name()}
+	for _, f := range fields {
+		if f.desc {
+			parts = append(parts, "orderdesc:"+f.pred)
+		} else {
+			parts = append(parts, "orderasc:"+f.pred)
+		}
+	}
+	return strings.Join(parts, " ")
+}
+
+// encodeCursor returns the cursor as URL-safe base64 text, with a checksum so that
+// corrupted cursors are rejected.
+func encodeCursor(c pageCursor) (string, error) {
+	data, err := json.Marshal(c)
+	if err != nil {
+		return "", err
+	}
+	data = binary.BigEndian.AppendUint32(data, crc32.ChecksumIEEE(data))
+	return base64.RawURLEncoding.EncodeToString(data), nil
+}
+
+// decodeCursor returns the cursor encoded by encodeCursor, it must have been returned for
+// the same type and sorting.
+func decodeCursor(s string, key string, fields []cursorField) (*pageCursor, error) {
+	data, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || len(data) < crc32.Size {
+		return nil, ErrInvalidCursor
+	}
+	payload, sum := data[:len(data)-crc32.Size], data[len(data)-crc32.Size:]
+	if crc32.ChecksumIEEE(payload) != binary.BigEndian.Uint32(sum) {
+		return nil, ErrInvalidCursor
+	}
+
+	var c pageCursor
+	dec := json.NewDecoder(bytes.NewReader(payload))
+	// numbers are kept as they were written, to compare them exactly
+	dec.UseNumber()
+	if err := dec.Decode(&c); err != nil {
+		return nil, ErrInvalidCursor
+	}
+	if c.Sort != key {
+		return nil, fmt.Errorf("%w: it is for another type or sorting", ErrInvalidCursor)
+	}
+	if len(c.Values) != len(fields) || c.Gid == 0 {
+		return nil, ErrInvalidCursor
+	}
+	// the values must decode into the sort fields, e.g. no string for an int field
+	for i, v := range c.Values {
+		switch v.(type) {
+		case json.Number, string:
+		default:
+			return nil, ErrInvalidCursor
+		}
+		data, err := json.Marshal(v)
+		if err != nil {
+			return nil, ErrInvalidCursor
+		}
+		if err := json.Unmarshal(data, reflect.New(fields[i].field.Type).Interface()); err != nil {
+			return nil, ErrInvalidCursor
+		}
+	}
+	return &c, nil
+}
+
+// valuesToQueryFuncs selects the objects sharing the values of the sort fields, and the
+// ones following them in the sorting: past the values of the first sort field, or
+// sharing them and past the values of the next one, and so on.
+func valuesToQueryFuncs(values []any, fields []cursorField) (eq, past querygen.QueryFunc) {
+	var qfs, eqs []querygen.QueryFunc
+	for i, f := range fields {
+		cmp := querygen.FuncGt
+		if f.desc {
+			cmp = querygen.FuncLt
+		}
+		qfs = append(qfs, querygen.And(append(append([]querygen.QueryFunc{}, eqs...),
+			querygen.BuildValueQuery(cmp, f.pred, values[i]))...))
+		eqs = append(eqs, querygen.BuildValueQuery(querygen.FuncEq, f.pred, values[i]))
+	}
+	return querygen.And(eqs...), querygen.Or(qfs...)
+}
+
+// sortValues returns the values of the sort fields of the object, and their JSON to
+// compare them.
+func sortValues[T any](obj T, fields []cursorField) ([]any, []byte, error) {
+	v := reflect.ValueOf(obj)
+	values := make([]any, len(fields))
+	for i, f := range fields {
+		values[i] = v.FieldByIndex(f.field.Index).Interface()
+	}
+	data, err := json.Marshal(values)
+	return values, data, err
+}
+
+// executeQueryPage runs the queries of a page of objects and counts the objects of all
+// the pages. The page is fetched with one more object than the limit to know if it is
+// the last. With sorting, the objects sharing the values of the sort fields are paged
+// in the order of their gids, which the sorting leaves unspecified: the objects sharing
+// the values of the cursor are fetched after its gid, and the ones sharing the values of
+// the last object of the page are fetched again by gid.
+func executeQueryPage[T any](ctx context.Context, txn *Txn, queryParams QueryParams) (*Page[T], error) {
+	var obj T
+	t := reflect.TypeOf(obj)
+
+	total, err := executeCount[T](ctx, txn, QueryParams{
+		Filter:        queryParams.Filter,
+		Edges:         queryParams.Edges,
+		Cascade:       queryParams.Cascade,
+		CascadeFields: queryParams.CascadeFields,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	var p Pagination
+	if queryParams.Pagination != nil {
+		p = *queryParams.Pagination
+	}
+	limit := p.Limit
+
+	// without a limit, the page has all the objects left and needs no cursor
+	if limit <= 0 && p.Cursor == "" {
+		gids, objs, err := executeQuery[T](ctx, txn, queryParams, true, nil)
+		if err != nil {
+			return nil, err
+		}
+		return &Page[T]{Gids: gids, Objs: objs, Total: total}, nil
+	}
+
+	fields, err := cursorFields(t, queryParams.Sorting)
+	if err != nil {
+		return nil, err
+	}
+	key := sortKey(t, fields)
+
+	var cursor *pageCursor
+	if p.Cursor != "" {
+		cursor, err = decodeCursor(p.Cursor, key, fields)
+		if err != nil {
+			return nil, err
+		}
+		p.Cursor, p.Offset, p.After = "", 0, ""
+	}
+
+	// fetch runs the query with the pagination, sorting and cursor filter given
+	fetch := func(p Pagination, sorting *Sorting, after querygen.QueryFunc) ([]uint64, []T, error) {
+		params := queryParams
+		params.Pagination, params.Sorting = &p, sorting
+		return executeQuery[T](ctx, txn, params, true, after)
+	}
+	// more returns the limit of the query of the objects left with n of them fetched
+	more := func(n int) int64 {
+		if limit <= 0 {
+			return 0
+		}
+		return limit + 1 - int64(n)
+	}
+
+	var gids []uint64
+	var objs []T
+	var past querygen.QueryFunc
+	if cursor != nil && len(fields) == 0 {
+		p.After = strconv.FormatUint(cursor.Gid, 10)
+	} else if cursor != nil {
+		var eq querygen.QueryFunc
+		eq, past = valuesToQueryFuncs(cursor.Values, fields)
+		gids, objs, err = fetch(Pagination{Limit: more(0), After: strconv.FormatUint(cursor.Gid, 10)}, nil, eq)
+		if err != nil {
+			return nil, err
+		}
+	}
+	// the objects sharing the values of the cursor are in the order of their gids
+	ordered := len(objs)
+	if limit <= 0 || int64(len(objs)) <= limit {
+		p.Limit = more(len(objs))
+		moreGids, moreObjs, err := fetch(p, queryParams.Sorting, past)
+		if err != nil {
+			return nil, err
+		}
+		gids, objs = append(gids, moreGids...), append(objs, moreObjs...)
+	}
+
+	page := &Page[T]{Gids: gids, Objs: objs, Total: total}
+	if limit <= 0 || int64(len(objs)) <= limit {
+		return page, nil
+	}
+	gids, objs = gids[:limit], objs[:limit]
+
+	next := pageCursor{Sort: key}
+	if len(fields) != 0 {
+		values, lastData, err := sortValues(objs[limit-1], fields)
+		if err != nil {
+			return nil, err
+		}
+		next.Values = values
+
+		start := int(limit) - 1
+		for start > ordered {
+			_, data, err := sortValues(objs[start-1], fields)
+			if err != nil {
+				return nil, err
+			}
+			if !bytes.Equal(data, lastData) {
+				break
+			}
+			start--
+		}
+		// an offset may have skipped some of the objects when they start the page
+		if start >= ordered && (start > 0 || p.Offset == 0) {
+			eq, _ := valuesToQueryFuncs(values, fields)
+			tieGids, tieObjs, err := fetch(Pagination{Limit: limit - int64(start)}, nil, eq)
+			if err != nil {
+				return nil, err
+			}
+			gids = append(gids[:start:start], tieGids...)
+			objs = append(objs[:start:start], tieObjs...)
+		}
+	}
+	next.Gid = gids[len(gids)-1]
+
+	page.Gids, page.Objs, page.HasNext = gids, objs, true
+	page.NextCursor, err = encodeCursor(next)
+	if err != nil {
+		return nil, err
+	}
+	return page, nil
+}
@@ -16,34 +16,34 @@ import (
 	"github.com/hypermodeinc/modusdb/api/structreflect"
 )
 
-func getByGid[T any](ctx context.Context, ns *Namespace, gid uint64) (uint64, T, error) {
-	return executeGet[T](ctx, ns, gid)
+func getByGid[T any](ctx context.Context, txn *Txn, gid uint64) (uint64, T, error) {
+	return executeGet[T](ctx, txn, gid)
 }
 
-func getByGidWithObject[T any](ctx context.Context, ns *Namespace, gid uint64, obj T) (uint64, T, error) {
-	return executeGetWithObject[T](ctx, ns, obj, false, gid)
+func getByGidWithObject[T any](ctx context.Context, txn *Txn, gid uint64, obj T) (uint64, T, error) {
+	return executeGetWithObject[T](ctx, txn, obj, false, gid)
 }
 
-func getByConstrainedField[T any](ctx context.Context, ns *Namespace, cf ConstrainedField) (uint64, T, error) {
-	return executeGet[T](ctx, ns, cf)
+func getByConstrainedField[T any](ctx context.Context, txn *Txn, cf ConstrainedField) (uint64, T, error) {
+	return executeGet[T](ctx, txn, cf)
 }
 
-func getByConstrainedFieldWithObject[T any](ctx context.Context, ns *Namespace,
+func getByConstrainedFieldWithObject[T any](ctx context.Context, txn *Txn,
 	cf ConstrainedField, obj T) (uint64, T, error) {
 
-	return executeGetWithObject[T](ctx, ns, obj, false, cf)
+	return executeGetWithObject[T](ctx, txn, obj, false, cf)
 }
 
-func executeGet[T any, R UniqueField](ctx context.Context, ns *Namespace, args ...R) (uint64, T, error) {
+func executeGet[T any, R UniqueField](ctx context.Context, txn *Txn, args ...R) (uint64, T, error) {
 	var obj T
 	if len(args) != 1 {
 		return 0, obj, fmt.Errorf("expected 1 argument, got %ds", len(args))
 	}
 
-	return executeGetWithObject(ctx, ns, obj, true, args...)
+	return executeGetWithObject(ctx, txn, obj, true, args...)
 }
 
-func executeGetWithObject[T any, R UniqueField](ctx context.Context, ns *Namespace,
+func executeGetWithObject[T any, R UniqueField](ctx context.Context, txn *Txn,
 	obj T, withReverse bool, args ...R) (uint64, T, error) {
 	t := reflect.TypeOf(obj)
 
@@ -51,22 +51,20 @@ func executeGetWithObject[T any, R UniqueField](ctx context.Context, ns *Namespa
 	if err != nil {
 		return 0, obj, err
 	}
-	readFromQuery := ""
-	if withReverse {
-		for jsonTag, reverseEdgeTag := range tagMaps.JsonToReverseEdge {
-			readFromQuery += fmt.Sprintf(querygen.ReverseEdgeQuery,
-				apiutils.GetPredicateName(t.Name(), jsonTag), reverseEdgeTag)
-		}
+	depth := readDepthFromContext(ctx)
+	fields, err := fieldsToQueryString(t, nil, depth, withReverse)
+	if err != nil {
+		return 0, obj, err
 	}
 
 	var cf ConstrainedField
 	var query string
 	gid, ok := any(args[0]).(uint64)
 	if ok {
-		query = querygen.FormatObjQuery(querygen.BuildUidQuery(gid), readFromQuery)
+		query = querygen.FormatObjQuery(querygen.BuildUidQuery(gid), fields)
 	} else if cf, ok = any(args[0]).(ConstrainedField); ok {
 		query = querygen.FormatObjQuery(querygen.BuildEqQuery(apiutils.GetPredicateName(t.Name(),
-			cf.Key), cf.Value), readFromQuery)
+			cf.Key), cf.Value), fields)
 	} else {
 		return 0, obj, fmt.Errorf("invalid unique field type")
 	}
@@ -75,12 +73,15 @@ func executeGetWithObject[T any, R UniqueField](ctx context.Context, ns *Namespa
 		return 0, obj, fmt.Errorf("constraint not defined for field %s", cf.Key)
 	}
 
-	resp, err := ns.engine.queryWithLock(ctx, ns, query)
+	resp, err := txn.queryWithLock(ctx, query)
 	if err != nil {
 		return 0, obj, err
 	}
 
-	dynamicType := structreflect.CreateDynamicStruct(t, tagMaps.FieldToJson, 1)
+	dynamicType, err := structreflect.CreateDynamicStruct(t, tagMaps.FieldToJson, depth)
+	if err != nil {
+		return 0, obj, err
+	}
 
 	dynamicInstance := reflect.New(dynamicType).Interface()
 
@@ -103,8 +104,10 @@ func executeGetWithObject[T any, R UniqueField](ctx context.Context, ns *Namespa
 	return structreflect.ConvertDynamicToTyped[T](result.Obj[0], t)
 }
 
-func executeQuery[T any](ctx context.Context, ns *Namespace, queryParams QueryParams,
-	withReverse bool) ([]uint64, []T, error) {
+// executeQuery runs the query of the objects, the ones not matching the after filter,
+// if any, are left out on top of the query parameters.
+func executeQuery[T any](ctx context.Context, txn *Txn, queryParams QueryParams,
+	withReverse bool, after querygen.QueryFunc) ([]uint64, []T, error) {
 	var obj T
 	t := reflect.TypeOf(obj)
 	tagMaps, err := structreflect.GetFieldTags(t)
@@ -115,43 +118,55 @@ func executeQuery[T any](ctx context.Context, ns *Namespace, queryParams QueryPa
 	var filterQueryFunc querygen.QueryFunc = func() string {
 		return ""
 	}
-	var paginationAndSorting string
 	if queryParams.Filter != nil {
-		filterQueryFunc = filtersToQueryFunc(t.Name(), *queryParams.Filter)
-	}
-	if queryParams.Pagination != nil || queryParams.Sorting != nil {
-		var pagination, sorting string
-		if queryParams.Pagination != nil {
-			pagination = paginationToQueryString(*queryParams.Pagination)
-		}
-		if queryParams.Sorting != nil {
-			sorting = sortingToQueryString(t.Name(), *queryParams.Sorting)
+		if err := validateFilter(t, *queryParams.Filter); err != nil {
+			return nil, nil, err
 		}
-		paginationAndSorting = fmt.Sprintf("%s %s", pagination, sorting)
+		filterQueryFunc = filterToQueryFunc(t.Name(), *queryParams.Filter)
 	}
-
-	readFromQuery := ""
-	if withReverse {
-		for jsonTag, reverseEdgeTag := range tagMaps.JsonToReverseEdge {
-			readFromQuery += fmt.Sprintf(querygen.ReverseEdgeQuery, apiutils.GetPredicateName(t.Name(), jsonTag), reverseEdgeTag)
-		}
+	if after != nil {
+		filterQueryFunc = querygen.And(filterQueryFunc, after)
+	}
+	depth := queryParams.Depth
+	if depth <= 0 {
+		depth = readDepthFromContext(ctx)
+	}
+	fields, err := fieldsToQueryString(t, queryParams.Edges, depth, withReverse)
+	if err != nil {
+		return nil, nil, err
 	}
 
-	query := querygen.FormatObjsQuery(t.Name(), filterQueryFunc, paginationAndSorting, readFromQuery)
+	var vars querygen.QueryVars
+	paginationAndSorting, err := paginationAndSortingToQueryString(t, queryParams, &vars)
+	if err != nil {
+		return nil, nil, err
+	}
+	query := querygen.FormatObjsQuery(t.Name(), filterQueryFunc, paginationAndSorting,
+		cascadeToQueryString(t.Name(), queryParams), fields, &vars)
 
-	resp, err := ns.engine.queryWithLock(ctx, ns, query)
+	resp, err := txn.queryWithVarsLock(ctx, query, vars.Values)
 	if err != nil {
 		return nil, nil, err
 	}
 
-	dynamicType := structreflect.CreateDynamicStruct(t, tagMaps.FieldToJson, 1)
+	return decodeObjs[T](resp.Json, t, tagMaps, max(depth, edgesDepth(queryParams.Edges)))
+}
+
+// decodeObjs returns the objects in the objs block of the query response, with their
+// edges down to depth levels.
+func decodeObjs[T any](respJson []byte, t reflect.Type, tagMaps *structreflect.TagMaps,
+	depth int) ([]uint64, []T, error) {
+	dynamicType, err := structreflect.CreateDynamicStruct(t, tagMaps.FieldToJson, depth)
+	if err != nil {
+		return nil, nil, err
+	}
 
 	var result struct {
 		Objs []any `json:"objs"`
 	}
 
 	var tempMap map[string][]any
-	if err := json.Unmarshal(resp.Json, &tempMap); err != nil {
+	if err := json.Unmarshal(respJson, &tempMap); err != nil {
 		return nil, nil, err
 	}
 
@@ -164,7 +179,7 @@ func executeQuery[T any](ctx context.Context, ns *Namespace, queryParams QueryPa
 	}
 
 	// Unmarshal the JSON response into the dynamic struct
-	if err := json.Unmarshal(resp.Json, &result); err != nil {
+	if err := json.Unmarshal(respJson, &result); err != nil {
 		return nil, nil, err
 	}
 
@@ -182,13 +197,195 @@ func executeQuery[T any](ctx context.Context, ns *Namespace, queryParams QueryPa
 	return gids, objs, nil
 }
 
-func getExistingObject[T any](ctx context.Context, ns *Namespace, gid uint64, cf *ConstrainedField,
+func executeCount[T any](ctx context.Context, txn *Txn, queryParams QueryParams) (int64, error) {
+	var obj T
+	t := reflect.TypeOf(obj)
+
+	var filterQueryFunc querygen.QueryFunc = func() string {
+		return ""
+	}
+	if queryParams.Filter != nil {
+		if err := validateFilter(t, *queryParams.Filter); err != nil {
+			return 0, err
+		}
+		filterQueryFunc = filterToQueryFunc(t.Name(), *queryParams.Filter)
+	}
+	// only the edges with parameters are fetched, for their filters and cascade
+	fields, err := fieldsToQueryString(t, queryParams.Edges, 0, true)
+	if err != nil {
+		return 0, err
+	}
+
+	var vars querygen.QueryVars
+	paginationAndSorting, err := paginationAndSortingToQueryString(t, queryParams, &vars)
+	if err != nil {
+		return 0, err
+	}
+	query := querygen.FormatCountQuery(t.Name(), filterQueryFunc, paginationAndSorting,
+		cascadeToQueryString(t.Name(), queryParams), fields, &vars)
+
+	resp, err := txn.queryWithVarsLock(ctx, query, vars.Values)
+	if err != nil {
+		return 0, err
+	}
+
+	var result struct {
+		Total []struct {
+			Count int64 `json:"count"`
+		} `json:"total"`
+	}
+	if err := json.Unmarshal(resp.Json, &result); err != nil {
+		return 0, err
+	}
+	if len(result.Total) == 0 {
+		return 0, nil
+	}
+	return result.Total[0].Count, nil
+}
+
+func executeAggregate[T any](ctx context.Context, txn *Txn, params AggregateParams) ([]AggregateResult, error) {
+	var obj T
+	t := reflect.TypeOf(obj)
+
+	var filterQueryFunc querygen.QueryFunc = func() string {
+		return ""
+	}
+	if params.Filter != nil {
+		if err := validateFilter(t, *params.Filter); err != nil {
+			return nil, err
+		}
+		filterQueryFunc = filterToQueryFunc(t.Name(), *params.Filter)
+	}
+
+	var attr string
+	if params.Field != "" {
+		field, err := filterField(t, params.Field)
+		if err != nil {
+			return nil, err
+		}
+		if !predicateAppliesTo("Int", field.Type) && !predicateAppliesTo("Float", field.Type) {
+			return nil, fmt.Errorf("field %s of type %s is not an int or float field", params.Field, t.Name())
+		}
+		attr = apiutils.GetPredicateName(t.Name(), params.Field)
+	}
+
+	if len(params.GroupBy) == 0 {
+		return executeAggregateAll(ctx, txn, querygen.FormatAggregateQuery(t.Name(), filterQueryFunc, attr))
+	}
+
+	groupBy := make([]string, len(params.GroupBy))
+	groupTypes := make([]reflect.Type, len(params.GroupBy))
+	for i, jsonName := range params.GroupBy {
+		field, err := filterField(t, jsonName)
+		if err != nil {
+			return nil, err
+		}
+		groupBy[i] = apiutils.GetPredicateName(t.Name(), jsonName)
+		groupTypes[i] = field.Type
+	}
+	resp, err := txn.queryWithLock(ctx, querygen.FormatGroupByQuery(t.Name(), filterQueryFunc, groupBy, attr))
+	if err != nil {
+		return nil, err
+	}
+
+	var result struct {
+		Objs []struct {
+			Groups []map[string]json.RawMessage `json:"@groupby"`
+		} `json:"objs"`
+	}
+	if err := json.Unmarshal(resp.Json, &result); err != nil {
+		return nil, err
+	}
+	if len(result.Objs) == 0 {
+		return nil, nil
+	}
+
+	aggs := make([]AggregateResult, len(result.Objs[0].Groups))
+	for i, group := range result.Objs[0].Groups {
+		aggs[i].Group = make(map[string]any, len(params.GroupBy))
+		for j, jsonName := range params.GroupBy {
+			raw, ok := group[groupBy[j]]
+			if !ok {
+				aggs[i].Group[jsonName] = nil
+				continue
+			}
+			// the values are decoded into the type of the field, as for the objects
+			value := reflect.New(groupTypes[j])
+			if err := json.Unmarshal(raw, value.Interface()); err != nil {
+				return nil, fmt.Errorf("error decoding group value of field %s: %w", jsonName, err)
+			}
+			aggs[i].Group[jsonName] = value.Elem().Interface()
+		}
+		aggs[i].Count = int64(rawFloat(group["count"]))
+		if attr != "" {
+			aggs[i].Min = rawFloat(group[fmt.Sprintf("min(%s)", attr)])
+			aggs[i].Max = rawFloat(group[fmt.Sprintf("max(%s)", attr)])
+			aggs[i].Sum = rawFloat(group[fmt.Sprintf("sum(%s)", attr)])
+			aggs[i].Avg = rawFloat(group[fmt.Sprintf("avg(%s)", attr)])
+		}
+	}
+	return aggs, nil
+}
+
+// executeAggregateAll runs the aggregate query of all the objects, without groups.
+func executeAggregateAll(ctx context.Context, txn *Txn, query string) ([]AggregateResult, error) {
+	resp, err := txn.queryWithLock(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	// every aggregate of the aggs block is returned in an object of its own
+	var result struct {
+		Total []struct {
+			Count int64 `json:"count"`
+		} `json:"total"`
+		Aggs []map[string]any `json:"aggs"`
+	}
+	if err := json.Unmarshal(resp.Json, &result); err != nil {
+		return nil, err
+	}
+
+	var agg AggregateResult
+	if len(result.Total) != 0 {
+		agg.Count = result.Total[0].Count
+	}
+	for _, a := range result.Aggs {
+		for name, value := range a {
+			switch name {
+			case "min":
+				agg.Min = toFloat(value)
+			case "max":
+				agg.Max = toFloat(value)
+			case "sum":
+				agg.Sum = toFloat(value)
+			case "avg":
+				agg.Avg = toFloat(value)
+			}
+		}
+	}
+	return []AggregateResult{agg}, nil
+}
+
+// toFloat returns the number decoded from JSON, zero for anything else.
+func toFloat(v any) float64 {
+	f, _ := v.(float64)
+	return f
+}
+
+// rawFloat returns the number in the JSON, zero for anything else.
+func rawFloat(raw json.RawMessage) float64 {
+	var f float64
+	_ = json.Unmarshal(raw, &f)
+	return f
+}
+
+func getExistingObject[T any](ctx context.Context, txn *Txn, gid uint64, cf *ConstrainedField,
 	object T) (uint64, error) {
 	var err error
 	if gid != 0 {
-		gid, _, err = getByGidWithObject[T](ctx, ns, gid, object)
+		gid, _, err = getByGidWithObject[T](ctx, txn, gid, object)
 	} else if cf != nil {
-		gid, _, err = getByConstrainedFieldWithObject[T](ctx, ns, *cf, object)
+		gid, _, err = getByConstrainedFieldWithObject[T](ctx, txn, *cf, object)
 	}
 	if err != nil {
 		return 0, err
@@ -196,8 +393,8 @@ func getExistingObject[T any](ctx context.Context, ns *Namespace, gid uint64, cf
 	return gid, nil
 }
 
-func getSchema(ctx context.Context, ns *Namespace) (*querygen.SchemaResponse, error) {
-	resp, err := ns.engine.queryWithLock(ctx, ns, querygen.SchemaQuery)
+func getSchema(ctx context.Context, txn *Txn) (*querygen.SchemaResponse, error) {
+	resp, err := txn.queryWithLock(ctx, querygen.SchemaQuery)
 	if err != nil {
 		return nil, err
 	}
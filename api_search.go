@@ -0,0 +1,339 @@
+/*
+ * SPDX-FileCopyrightText: © Hypermode Inc. <hello@hypermode.com>
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package modusdb
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"math"
+	"reflect"
+	"slices"
+	"sort"
+
+	"github.com/hypermodeinc/dgraph/v24/tok"
+	"github.com/hypermodeinc/modusdb/api/apiutils"
+	"github.com/hypermodeinc/modusdb/api/querygen"
+	"github.com/hypermodeinc/modusdb/api/structreflect"
+)
+
+// HybridFusion is the way HybridSearch merges the results of its vector and text searches.
+type HybridFusion int
+
+const (
+	// FusionReciprocalRank scores the objects by the sum of 1/(k+rank) over the searches
+	// matching them, with k the RankConstant and ranks starting at 1.
+	FusionReciprocalRank HybridFusion = iota
+	// FusionWeighted scores the objects by the weighted sum of their scores in the searches,
+	// both between 0 and 1.
+	FusionWeighted
+)
+
+const defaultRankConstant = 60
+
+// HybridSearchParams configures HybridSearch.
+type HybridSearchParams struct {
+	// Filter selects the objects searched, along with the searches.
+	Filter *Filter
+	// VectorField is the json name of the field with a vector index searched for the
+	// vectors most similar to SimilarTo.
+	VectorField string
+	SimilarTo   []float32
+	// TextField is the json name of the field with a term or fulltext index searched for
+	// the terms of Text, split as by the index. The objects are scored by the share of the
+	// terms they match, with a fulltext index the words of Text sharing a stem count once
+	// and its stop words are left out.
+	TextField string
+	Text      string
+	// TopK is the number of objects kept from each search, and returned.
+	TopK int64
+	// MaxDistance, if set, leaves out the objects farther than it from the vector search.
+	MaxDistance *float64
+	Fusion      HybridFusion
+	// RankConstant is the k of FusionReciprocalRank, it defaults to 60.
+	RankConstant float64
+	// VectorWeight and TextWeight weigh the scores of the searches with FusionWeighted,
+	// the searches weigh the same when both are zero.
+	VectorWeight float64
+	TextWeight   float64
+}
+
+// VectorSearchParams configures VectorSearch.
+type VectorSearchParams struct {
+	// Field is the json name of the field with a vector index searched for the TopK
+	// vectors closest to SimilarTo.
+	Field     string
+	SimilarTo []float32
+	TopK      int64
+	// Filter selects the objects among the closest ones.
+	Filter *Filter
+	// MaxDistance, if set, leaves out the objects farther than it.
+	MaxDistance *float64
+}
+
+// SearchResult is an object found by a search, with its score, higher scores first.
+type SearchResult[T any] struct {
+	Gid   uint64
+	Obj   T
+	Score float64
+	// Distance is the distance of the vector of the object to the vector searched for,
+	// with the metric of the vector index: 1 - the cosine similarity for cosine, the
+	// euclidean distance for euclidean, and the negated dot product for dotproduct. It
+	// is zero for the objects only found by a text search.
+	Distance float64
+}
+
+// distanceScore returns the score of the distance with the metric, between 0 and 1.
+func distanceScore(metric string, distance float64) float64 {
+	switch metric {
+	case structreflect.MetricEuclidean:
+		return 1 / (1 + distance)
+	case structreflect.MetricDotProduct:
+		return 1 / (1 + math.Exp(distance))
+	default:
+		return 1 - distance/2
+	}
+}
+
+// searchTerms returns the terms of the text, as split by the term index. With a fulltext
+// index, the words without a stem, the stop words, are left out, and only the first word
+// of each stem is kept.
+func searchTerms(text string, fulltext bool) ([]string, error) {
+	tokens, err := tok.TermTokenizer{}.Tokens(text)
+	if err != nil {
+		return nil, err
+	}
+	tokens = slices.DeleteFunc(tokens, func(term string) bool {
+		return term == ""
+	})
+	if !fulltext {
+		return tokens, nil
+	}
+
+	var terms []string
+	stems := make(map[string]bool)
+	for _, term := range tokens {
+		// the language is left empty as in the queries
+		ftTokens, err := tok.GetFullTextTokens([]string{term}, "")
+		if err != nil {
+			return nil, err
+		}
+		if len(ftTokens) == 0 || stems[ftTokens[0]] {
+			continue
+		}
+		stems[ftTokens[0]] = true
+		terms = append(terms, term)
+	}
+	return terms, nil
+}
+
+func executeHybridSearch[T any](ctx context.Context, txn *Txn, params HybridSearchParams) ([]SearchResult[T], error) {
+	var obj T
+	t := reflect.TypeOf(obj)
+
+	if params.TopK <= 0 {
+		return nil, fmt.Errorf("hybrid search needs a positive TopK")
+	}
+	// the vector field and vector are checked by the vector search
+	if _, err := indexedField(t, params.TextField, "term", "fulltext"); err != nil {
+		return nil, err
+	}
+	tagMaps, err := structreflect.GetFieldTags(t)
+	if err != nil {
+		return nil, err
+	}
+	fulltext := tagMaps.JsonToDb[params.TextField].Constraint == "fulltext"
+	terms, err := searchTerms(params.Text, fulltext)
+	if err != nil {
+		return nil, err
+	}
+	if len(terms) == 0 {
+		return nil, fmt.Errorf("hybrid search needs terms to search for")
+	}
+
+	vectorResults, err := executeVectorSearch[T](ctx, txn, VectorSearchParams{
+		Field:       params.VectorField,
+		SimilarTo:   params.SimilarTo,
+		TopK:        params.TopK,
+		Filter:      params.Filter,
+		MaxDistance: params.MaxDistance,
+	})
+	if err != nil {
+		return nil, err
+	}
+
+	textResults, err := executeTermSearch[T](ctx, txn, params.TextField, terms, fulltext, params.TopK,
+		params.Filter)
+	if err != nil {
+		return nil, err
+	}
+
+	rankConstant := params.RankConstant
+	if rankConstant <= 0 {
+		rankConstant = defaultRankConstant
+	}
+	vectorWeight, textWeight := params.VectorWeight, params.TextWeight
+	if vectorWeight == 0 && textWeight == 0 {
+		vectorWeight, textWeight = 0.5, 0.5
+	}
+
+	var fused []SearchResult[T]
+	index := make(map[uint64]int)
+	for _, search := range []struct {
+		results []SearchResult[T]
+		weight  float64
+	}{
+		{vectorResults, vectorWeight},
+		{textResults, textWeight},
+	} {
+		for rank, result := range search.results {
+			score := search.weight * result.Score
+			if params.Fusion == FusionReciprocalRank {
+				score = 1 / (rankConstant + float64(rank+1))
+			}
+			if i, ok := index[result.Gid]; ok {
+				fused[i].Score += score
+				continue
+			}
+			index[result.Gid] = len(fused)
+			result.Score = score
+			fused = append(fused, result)
+		}
+	}
+
+	sort.SliceStable(fused, func(i, j int) bool {
+		return fused[i].Score > fused[j].Score
+	})
+	if int64(len(fused)) > params.TopK {
+		fused = fused[:params.TopK]
+	}
+	return fused, nil
+}
+
+// executeTermSearch returns the topK objects matching the most terms with the term or
+// fulltext index of the field, scored by the share of the terms they match.
+func executeTermSearch[T any](ctx context.Context, txn *Txn, field string, terms []string, fulltext bool,
+	topK int64, filter *Filter) ([]SearchResult[T], error) {
+	var obj T
+	t := reflect.TypeOf(obj)
+	tagMaps, err := structreflect.GetFieldTags(t)
+	if err != nil {
+		return nil, err
+	}
+
+	var filterQueryFunc querygen.QueryFunc = func() string {
+		return ""
+	}
+	if filter != nil {
+		if err := validateFilter(t, *filter); err != nil {
+			return nil, err
+		}
+		filterQueryFunc = filterToQueryFunc(t.Name(), *filter)
+	}
+	depth := readDepthFromContext(ctx)
+	fields, err := fieldsToQueryString(t, nil, depth, true)
+	if err != nil {
+		return nil, err
+	}
+
+	match := querygen.BuildAnyOfTermsQuery
+	if fulltext {
+		match = querygen.BuildAnyOfTextQuery
+	}
+	query := querygen.FormatTermSearchQuery("match", t.Name(), apiutils.GetPredicateName(t.Name(), field),
+		terms, match, topK, filterQueryFunc, fields)
+	resp, err := txn.queryWithLock(ctx, query)
+	if err != nil {
+		return nil, err
+	}
+
+	gids, objs, err := decodeObjs[T](resp.Json, t, tagMaps, depth)
+	if err != nil {
+		return nil, err
+	}
+	var scores struct {
+		Objs []struct {
+			Score float64 `json:"score"`
+		} `json:"objs"`
+	}
+	if err := json.Unmarshal(resp.Json, &scores); err != nil {
+		return nil, err
+	}
+
+	results := make([]SearchResult[T], len(objs))
+	for i, obj := range objs {
+		results[i] = SearchResult[T]{Gid: gids[i], Obj: obj, Score: scores.Objs[i].Score}
+	}
+	return results, nil
+}
+
+func executeVectorSearch[T any](ctx context.Context, txn *Txn, params VectorSearchParams) ([]SearchResult[T], error) {
+	var obj T
+	t := reflect.TypeOf(obj)
+
+	if params.TopK <= 0 {
+		return nil, fmt.Errorf("vector search needs a positive TopK")
+	}
+	if len(params.SimilarTo) == 0 {
+		return nil, fmt.Errorf("vector search needs a vector to search for")
+	}
+	if _, err := indexedField(t, params.Field, "vector"); err != nil {
+		return nil, err
+	}
+	tagMaps, err := structreflect.GetFieldTags(t)
+	if err != nil {
+		return nil, err
+	}
+	metric := tagMaps.JsonToDb[params.Field].VectorMetric()
+
+	var filterQueryFunc querygen.QueryFunc = func() string {
+		return ""
+	}
+	if params.Filter != nil {
+		if err := validateFilter(t, *params.Filter); err != nil {
+			return nil, err
+		}
+		filterQueryFunc = filterToQueryFunc(t.Name(), *params.Filter)
+	}
+	depth := readDepthFromContext(ctx)
+	fields, err := fieldsToQueryString(t, nil, depth, true)
+	if err != nil {
+		return nil, err
+	}
+
+	var vars querygen.QueryVars
+	query := querygen.FormatVectorSearchQuery("similarity", apiutils.GetPredicateName(t.Name(), params.Field),
+		metric, params.SimilarTo, params.TopK, filterQueryFunc, params.MaxDistance, fields, &vars)
+	resp, err := txn.queryWithVarsLock(ctx, query, vars.Values)
+	if err != nil {
+		return nil, err
+	}
+
+	gids, objs, err := decodeObjs[T](resp.Json, t, tagMaps, depth)
+	if err != nil {
+		return nil, err
+	}
+	var distances struct {
+		Objs []struct {
+			Distance float64 `json:"distance"`
+		} `json:"objs"`
+	}
+	if err := json.Unmarshal(resp.Json, &distances); err != nil {
+		return nil, err
+	}
+
+	results := make([]SearchResult[T], len(objs))
+	for i, obj := range objs {
+		distance := distances.Objs[i].Distance
+		results[i] = SearchResult[T]{
+			Gid:      gids[i],
+			Obj:      obj,
+			Score:    distanceScore(metric, distance),
+			Distance: distance,
+		}
+	}
+	return results, nil
+}
@@ -7,12 +7,19 @@ package modusdb
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"reflect"
+	"slices"
+	"strconv"
 	"strings"
+	"time"
 
 	"github.com/hypermodeinc/dgraph/v24/x"
 	"github.com/hypermodeinc/modusdb/api/apiutils"
 	"github.com/hypermodeinc/modusdb/api/querygen"
+	"github.com/hypermodeinc/modusdb/api/structreflect"
+	"github.com/twpayne/go-geom"
 )
 
 type UniqueField interface {
@@ -27,29 +34,124 @@ type QueryParams struct {
 	Filter     *Filter
 	Pagination *Pagination
 	Sorting    *Sorting
+	// Edges has the parameters of the nested struct, pointer and slice fields, keyed by
+	// their json names, with the fields of their own type. The edges of nested objects
+	// are only fetched when they are in Edges.
+	Edges map[string]QueryParams
+	// Depth is the number of levels of edges fetched along with the objects, it defaults
+	// to the depth set with ContextWithReadDepth, or 1. The edges in Edges are fetched
+	// regardless of the depth, and their own Depth is ignored.
+	Depth int
+	// Cascade drops the objects missing any of the fields fetched, e.g. the objects
+	// whose edges have nothing left after the filters of Edges. Only the fields in
+	// CascadeFields, if any, are checked.
+	Cascade       bool
+	CascadeFields []string
 }
 
+// AggregateParams configures Aggregate.
+type AggregateParams struct {
+	Filter *Filter
+	// Field is the int or float field aggregated, the objects are only counted without it.
+	Field string
+	// GroupBy has the fields the objects are grouped by, an AggregateResult is returned
+	// for every group of objects sharing the same values of the fields.
+	GroupBy []string
+}
+
+// AggregateResult has the number of objects of a group and the aggregates of the values
+// of AggregateParams.Field for the objects that have one.
+type AggregateResult struct {
+	// Group has the values of the GroupBy fields of the group, keyed by their json names,
+	// with the Go types of the fields. It is nil without GroupBy.
+	Group map[string]any
+	Count int64
+	Min   float64
+	Max   float64
+	Sum   float64
+	Avg   float64
+}
+
+// Filter selects the objects by one of the predicates on Field, combined with the
+// filters in AllOf, AnyOf, And, Or and Not. Filters are built into a tree with the
+// AllOf, AnyOf and Not functions, e.g. AnyOf(f1, AllOf(f2, Not(f3))).
 type Filter struct {
 	Field  string
 	String StringPredicate
+	Int    IntPredicate
+	Float  FloatPredicate
+	Bool   BoolPredicate
+	Time   TimePredicate
+	Geo    GeoPredicate
 	Vector VectorPredicate
-	And    *Filter
-	Or     *Filter
-	Not    *Filter
+	// AllOf and AnyOf match the objects matched by all or any of their filters, along
+	// with the predicate of the filter and And and Not.
+	AllOf []Filter
+	AnyOf []Filter
+	// And is combined with the predicate of the filter.
+	//
+	// Deprecated: Use AllOf, or build the filter with the AllOf function.
+	And *Filter
+	// Or matches the objects matched by either the rest of the filter or Or.
+	//
+	// Deprecated: Use AnyOf, or build the filter with the AnyOf function.
+	Or *Filter
+	// Not is combined with the predicate of the filter, matching the objects it does
+	// not match, see the Not function.
+	Not *Filter
+}
+
+// AllOf returns a filter matching the objects matched by all the filters.
+func AllOf(filters ...Filter) Filter {
+	return Filter{AllOf: filters}
+}
+
+// AnyOf returns a filter matching the objects matched by any of the filters.
+func AnyOf(filters ...Filter) Filter {
+	return Filter{AnyOf: filters}
+}
+
+// Not returns a filter matching the objects not matched by the filter.
+func Not(filter Filter) Filter {
+	return Filter{Not: &filter}
 }
 
 type Pagination struct {
 	Limit  int64
 	Offset int64
-	After  string
+	// After is the gid, decimal or 0x-prefixed hex, of the object the objects returned
+	// follow in gid order. It is ignored along with Offset when Cursor is set.
+	After string
+	// Cursor is the Page.NextCursor of the previous page returned by QueryPage, with the
+	// same type and sorting. It is only supported by QueryPage.
+	Cursor string
 }
 
+// Sorting orders the objects by the keys in Keys, or by one ascending and one descending
+// field, the descending one first with OrderDescFirst.
 type Sorting struct {
+	// Keys are applied in order, each one ordering the objects left tied by the previous
+	// ones. They can't be set along with the fields below.
+	Keys           []SortKey
 	OrderAscField  string
 	OrderDescField string
 	OrderDescFirst bool
 }
 
+// SortKey orders the objects by an int, float, string or time field, ascending unless
+// Desc is set.
+type SortKey struct {
+	// Field is the json name of the field, or a path of edges to a field of the objects
+	// they reach, e.g. "writer.name". Objects are ordered by the smallest value reached,
+	// or the largest when Desc is set. Paths are only supported at the root of a query.
+	Field string
+	Desc  bool
+	// SimilarTo orders the objects by the distance of the vectors of Field to it with
+	// the metric of the vector index of Field, the most similar first. It is only
+	// supported at the root of a query.
+	SimilarTo []float32
+}
+
 type StringPredicate struct {
 	Equals         string
 	LessThan       string
@@ -63,6 +165,57 @@ type StringPredicate struct {
 	RegExp         string
 }
 
+// IntPredicate compares an int field, the comparisons set are all applied, e.g.
+// GreaterOrEqual and LessThan together select a range.
+type IntPredicate struct {
+	Equals         *int64
+	LessThan       *int64
+	LessOrEqual    *int64
+	GreaterThan    *int64
+	GreaterOrEqual *int64
+}
+
+// FloatPredicate compares a float field, the comparisons set are all applied.
+type FloatPredicate struct {
+	Equals         *float64
+	LessThan       *float64
+	LessOrEqual    *float64
+	GreaterThan    *float64
+	GreaterOrEqual *float64
+}
+
+type BoolPredicate struct {
+	Equals *bool
+}
+
+// TimePredicate compares a time.Time field, the comparisons set are all applied.
+type TimePredicate struct {
+	Equals     *time.Time
+	Before     *time.Time
+	BeforeOrAt *time.Time
+	After      *time.Time
+	AfterOrAt  *time.Time
+}
+
+// GeoPredicate selects the objects by the location of a geom.Point field, which needs
+// the geo index given by the db:"constraint=geo" tag. The areas are *geom.Polygon or
+// *geom.MultiPolygon values.
+type GeoPredicate struct {
+	// Near selects the points within NearDistance meters of the point.
+	Near         *geom.Point
+	NearDistance float64
+	Within       geom.T
+	// Contains selects the areas containing the point or polygon, it only applies to
+	// fields storing areas.
+	Contains   geom.T
+	Intersects geom.T
+}
+
+// VectorPredicate selects the TopK objects with the vectors most similar to SimilarTo,
+// without their distances.
+//
+// Deprecated: Use VectorSearch, which returns the distances of the objects and can leave
+// out the ones farther than a MaxDistance.
 type VectorPredicate struct {
 	SimilarTo []float32
 	TopK      int64
@@ -80,6 +233,23 @@ func WithNamespace(ns uint64) ModusDbOption {
 	}
 }
 
+const defaultReadDepth = 1
+
+type readDepthCtxKey struct{}
+
+// ContextWithReadDepth returns a copy of ctx that sets the number of levels of edges
+// fetched by Get and Query along with the objects. See QueryParams.Depth.
+func ContextWithReadDepth(ctx context.Context, depth int) context.Context {
+	return context.WithValue(ctx, readDepthCtxKey{}, depth)
+}
+
+func readDepthFromContext(ctx context.Context) int {
+	if depth, ok := ctx.Value(readDepthCtxKey{}).(int); ok && depth > 0 {
+		return depth
+	}
+	return defaultReadDepth
+}
+
 func getDefaultNamespace(ctx context.Context, engine *Engine, nsId ...uint64) (context.Context, *Namespace, error) {
 	dbOpts := &modusDbOptions{
 		ns: engine.db0.ID(),
@@ -98,19 +268,92 @@ func getDefaultNamespace(ctx context.Context, engine *Engine, nsId ...uint64) (c
 	return ctx, d, nil
 }
 
+// getDefaultTxn returns the transaction attached to the context, or a new transaction
+// on the requested namespace. The returned finish function must be called with the
+// result of the operation, it commits or discards the transaction if it was created here.
+func getDefaultTxn(ctx context.Context, engine *Engine, readOnly bool,
+	nsId ...uint64) (context.Context, *Txn, func(error) error, error) {
+	if txn := txnFromContext(ctx); txn != nil {
+		if txn.ns.engine != engine {
+			return nil, nil, nil, fmt.Errorf("transaction belongs to a different engine")
+		}
+		if len(nsId) > 0 && nsId[0] != txn.ns.ID() {
+			return nil, nil, nil, fmt.Errorf("namespace %d does not match the transaction namespace %d",
+				nsId[0], txn.ns.ID())
+		}
+		if !readOnly && txn.readOnly {
+			return nil, nil, nil, ErrReadOnlyTxn
+		}
+		ctx = x.AttachNamespace(ctx, txn.ns.ID())
+		if readOnly {
+			txn.mutex.RLock()
+			return ctx, txn, func(err error) error {
+				txn.mutex.RUnlock()
+				return err
+			}, nil
+		}
+		txn.mutex.Lock()
+		return ctx, txn, func(err error) error {
+			txn.mutex.Unlock()
+			return err
+		}, nil
+	}
+
+	ctx, ns, err := getDefaultNamespace(ctx, engine, nsId...)
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	if readOnly {
+		txn := ns.newReadOnlyTxnWithLock()
+		finish := func(err error) error {
+			txn.release()
+			return err
+		}
+		return ctx, txn, finish, nil
+	}
+
+	txn, err := ns.newTxnWithLock()
+	if err != nil {
+		return nil, nil, nil, err
+	}
+	finish := func(err error) error {
+		if err != nil {
+			return errors.Join(err, txn.discardWithLock(ctx))
+		}
+		return txn.commitWithLock(ctx)
+	}
+	return ctx, txn, finish, nil
+}
+
 func filterToQueryFunc(typeName string, f Filter) querygen.QueryFunc {
-	// Handle logical operators first
-	if f.And != nil {
-		return querygen.And(filterToQueryFunc(typeName, *f.And))
+	qfs := []querygen.QueryFunc{predicateToQueryFunc(typeName, f)}
+	for _, sub := range f.AllOf {
+		qfs = append(qfs, filterToQueryFunc(typeName, sub))
 	}
-	if f.Or != nil {
-		return querygen.Or(filterToQueryFunc(typeName, *f.Or))
+	if len(f.AnyOf) != 0 {
+		anyOf := make([]querygen.QueryFunc, len(f.AnyOf))
+		for i, sub := range f.AnyOf {
+			anyOf[i] = filterToQueryFunc(typeName, sub)
+		}
+		qfs = append(qfs, querygen.Or(anyOf...))
+	}
+	if f.And != nil {
+		qfs = append(qfs, filterToQueryFunc(typeName, *f.And))
 	}
 	if f.Not != nil {
-		return querygen.Not(filterToQueryFunc(typeName, *f.Not))
+		qfs = append(qfs, querygen.Not(filterToQueryFunc(typeName, *f.Not)))
+	}
+
+	qf := querygen.And(qfs...)
+	if f.Or != nil {
+		qf = querygen.Or(qf, filterToQueryFunc(typeName, *f.Or))
 	}
+	return qf
+}
 
-	// Handle field predicates
+// predicateToQueryFunc returns the predicate of the filter on its field, without the
+// filters combined with it.
+func predicateToQueryFunc(typeName string, f Filter) querygen.QueryFunc {
 	if f.String.Equals != "" {
 		return querygen.BuildEqQuery(apiutils.GetPredicateName(typeName, f.Field), f.String.Equals)
 	}
@@ -150,6 +393,34 @@ func filterToQueryFunc(typeName string, f Filter) querygen.QueryFunc {
 		return querygen.BuildGeQuery(apiutils.GetPredicateName(typeName,
 			f.Field), f.String.GreaterOrEqual)
 	}
+	pred := apiutils.GetPredicateName(typeName, f.Field)
+	if qfs := comparisonsToQueryFuncs(pred, f.Int.Equals, f.Int.LessThan, f.Int.LessOrEqual,
+		f.Int.GreaterThan, f.Int.GreaterOrEqual); len(qfs) != 0 {
+		return querygen.And(qfs...)
+	}
+	if qfs := comparisonsToQueryFuncs(pred, f.Float.Equals, f.Float.LessThan, f.Float.LessOrEqual,
+		f.Float.GreaterThan, f.Float.GreaterOrEqual); len(qfs) != 0 {
+		return querygen.And(qfs...)
+	}
+	if f.Bool.Equals != nil {
+		return querygen.BuildValueQuery(querygen.FuncEq, pred, *f.Bool.Equals)
+	}
+	if qfs := comparisonsToQueryFuncs(pred, f.Time.Equals, f.Time.Before, f.Time.BeforeOrAt,
+		f.Time.After, f.Time.AfterOrAt); len(qfs) != 0 {
+		return querygen.And(qfs...)
+	}
+	if f.Geo.Near != nil {
+		return querygen.BuildNearQuery(pred, f.Geo.Near, f.Geo.NearDistance)
+	}
+	if f.Geo.Within != nil {
+		return querygen.BuildWithinQuery(pred, f.Geo.Within)
+	}
+	if f.Geo.Contains != nil {
+		return querygen.BuildContainsQuery(pred, f.Geo.Contains)
+	}
+	if f.Geo.Intersects != nil {
+		return querygen.BuildIntersectsQuery(pred, f.Geo.Intersects)
+	}
 	if f.Vector.SimilarTo != nil {
 		return querygen.BuildSimilarToQuery(apiutils.GetPredicateName(typeName,
 			f.Field), f.Vector.TopK, f.Vector.SimilarTo)
@@ -159,12 +430,246 @@ func filterToQueryFunc(typeName string, f Filter) querygen.QueryFunc {
 	return func() string { return "" }
 }
 
-// Helper function to combine multiple filters
-func filtersToQueryFunc(typeName string, filter Filter) querygen.QueryFunc {
-	return filterToQueryFunc(typeName, filter)
+// validateFilter checks that the fields of the filters in the tree are fields of the
+// type holding values, and that their predicates apply to the values of the fields.
+func validateFilter(t reflect.Type, f Filter) error {
+	var predicates []string
+	for name, predicate := range map[string]any{
+		"String": f.String,
+		"Int":    f.Int,
+		"Float":  f.Float,
+		"Bool":   f.Bool,
+		"Time":   f.Time,
+		"Geo":    f.Geo,
+		"Vector": f.Vector,
+	} {
+		if !reflect.ValueOf(predicate).IsZero() {
+			predicates = append(predicates, name)
+		}
+	}
+
+	switch {
+	case len(predicates) > 1:
+		return fmt.Errorf("filter on field %s of type %s has more than one predicate", f.Field, t.Name())
+	case len(predicates) == 1 && f.Field == "":
+		return fmt.Errorf("filter with a %s predicate has no field", predicates[0])
+	case len(predicates) == 0 && f.Field != "":
+		return fmt.Errorf("filter on field %s of type %s has no predicate", f.Field, t.Name())
+	case len(predicates) == 1:
+		field, err := filterField(t, f.Field)
+		if err != nil {
+			return err
+		}
+		if !predicateAppliesTo(predicates[0], field.Type) {
+			return fmt.Errorf("%s predicate cannot be applied to field %s of type %s",
+				predicates[0], f.Field, t.Name())
+		}
+	}
+
+	for _, sub := range append(append([]Filter{}, f.AllOf...), f.AnyOf...) {
+		if err := validateFilter(t, sub); err != nil {
+			return err
+		}
+	}
+	for _, sub := range []*Filter{f.And, f.Or, f.Not} {
+		if sub == nil {
+			continue
+		}
+		if err := validateFilter(t, *sub); err != nil {
+			return err
+		}
+	}
+	return nil
 }
 
-func paginationToQueryString(p Pagination) string {
+// filterField returns the field of the type with the json name, it must hold values.
+func filterField(t reflect.Type, jsonName string) (reflect.StructField, error) {
+	tagMaps, err := structreflect.GetFieldTags(t)
+	if err != nil {
+		return reflect.StructField{}, err
+	}
+	for fieldName, name := range tagMaps.FieldToJson {
+		if name != jsonName {
+			continue
+		}
+		field, _ := t.FieldByName(fieldName)
+		if fieldName == "Gid" || structreflect.EdgeType(field.Type) != nil ||
+			tagMaps.JsonToReverseEdge[jsonName] != "" {
+			break
+		}
+		return field, nil
+	}
+	return reflect.StructField{}, fmt.Errorf("type %s has no field %s to filter on", t.Name(), jsonName)
+}
+
+// predicateAppliesTo reports whether the predicate can compare values of the type,
+// String predicates apply to every value.
+func predicateAppliesTo(predicate string, t reflect.Type) bool {
+	switch predicate {
+	case "Int":
+		switch t.Kind() {
+		case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+			reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32:
+			return true
+		}
+		return false
+	case "Float":
+		return t.Kind() == reflect.Float32 || t.Kind() == reflect.Float64
+	case "Bool":
+		return t.Kind() == reflect.Bool
+	case "Time":
+		return t == reflect.TypeOf(time.Time{})
+	case "Geo":
+		return t == reflect.TypeOf(geom.Point{})
+	case "Vector":
+		return t == reflect.TypeOf([]float32{}) || t == reflect.TypeOf([]float64{})
+	default:
+		return true
+	}
+}
+
+// comparisonsToQueryFuncs returns the comparisons of the predicate with the values set.
+func comparisonsToQueryFuncs[V int64 | float64 | time.Time](pred string,
+	eq, lt, le, gt, ge *V) []querygen.QueryFunc {
+
+	var qfs []querygen.QueryFunc
+	for _, c := range []struct {
+		format string
+		value  *V
+	}{
+		{querygen.FuncEq, eq},
+		{querygen.FuncLt, lt},
+		{querygen.FuncLe, le},
+		{querygen.FuncGt, gt},
+		{querygen.FuncGe, ge},
+	} {
+		if c.value != nil {
+			qfs = append(qfs, querygen.BuildValueQuery(c.format, pred, *c.value))
+		}
+	}
+	return qfs
+}
+
+// paginationAndSortingToQueryString returns the pagination and sorting arguments of the
+// objects of the type. The variables of the sort keys needing them are added to vars,
+// such keys are rejected without vars.
+func paginationAndSortingToQueryString(t reflect.Type, params QueryParams,
+	vars *querygen.QueryVars) (string, error) {
+	if params.Pagination == nil && params.Sorting == nil {
+		return "", nil
+	}
+	var pagination, sorting string
+	var err error
+	if params.Pagination != nil {
+		pagination, err = paginationToQueryString(*params.Pagination)
+		if err != nil {
+			return "", err
+		}
+	}
+	if params.Sorting != nil {
+		sorting, err = sortingToQueryString(t, *params.Sorting, vars)
+		if err != nil {
+			return "", err
+		}
+	}
+	return fmt.Sprintf("%s %s", pagination, sorting), nil
+}
+
+func cascadeToQueryString(typeName string, params QueryParams) string {
+	if !params.Cascade {
+		return ""
+	}
+	preds := make([]string, len(params.CascadeFields))
+	for i, field := range params.CascadeFields {
+		preds[i] = apiutils.GetPredicateName(typeName, field)
+	}
+	return querygen.FormatCascade(preds)
+}
+
+// fieldsToQueryString returns the fields of the type to fetch in a query. Edges are
+// fetched with their parameters in edges, the edges not in edges are fetched down to
+// depth levels, along with the reverse edges when withReverse is set.
+func fieldsToQueryString(t reflect.Type, edges map[string]QueryParams, depth int, withReverse bool) (string, error) {
+	tagMaps, err := structreflect.GetFieldTags(t)
+	if err != nil {
+		return "", err
+	}
+
+	edgeFields := make(map[string]reflect.Type)
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if edgeType := structreflect.EdgeType(field.Type); edgeType != nil {
+			edgeFields[tagMaps.FieldToJson[field.Name]] = edgeType
+		}
+	}
+	for jsonName := range edges {
+		if edgeFields[jsonName] == nil {
+			return "", fmt.Errorf("field %s of type %s is not an edge", jsonName, t.Name())
+		}
+	}
+
+	var fields []string
+	for i := 0; i < t.NumField(); i++ {
+		field := t.Field(i)
+		if field.Name == "Gid" {
+			continue
+		}
+		jsonName := tagMaps.FieldToJson[field.Name]
+		pred := apiutils.GetPredicateName(t.Name(), jsonName)
+		reverseEdge := tagMaps.JsonToReverseEdge[jsonName]
+
+		edgeType := edgeFields[jsonName]
+		if edgeType == nil {
+			if reverseEdge == "" {
+				fields = append(fields, pred)
+			}
+			continue
+		}
+		params, ok := edges[jsonName]
+		if !ok && (depth <= 0 || (reverseEdge != "" && !withReverse)) {
+			continue
+		}
+		if reverseEdge != "" {
+			pred = fmt.Sprintf("%s: ~%s", pred, reverseEdge)
+		}
+
+		edgeFieldsQuery, err := fieldsToQueryString(edgeType, params.Edges, depth-1, withReverse)
+		if err != nil {
+			return "", err
+		}
+		var filter querygen.QueryFunc = func() string {
+			return ""
+		}
+		if params.Filter != nil {
+			if err := validateFilter(edgeType, *params.Filter); err != nil {
+				return "", err
+			}
+			filter = filterToQueryFunc(edgeType.Name(), *params.Filter)
+		}
+		paginationAndSorting, err := paginationAndSortingToQueryString(edgeType, params, nil)
+		if err != nil {
+			return "", err
+		}
+		paginationAndSorting = strings.TrimPrefix(strings.TrimSpace(paginationAndSorting), ", ")
+		fields = append(fields, querygen.FormatEdgeQuery(pred, filter, paginationAndSorting,
+			cascadeToQueryString(edgeType.Name(), params), edgeFieldsQuery))
+	}
+	return strings.Join(fields, "\n"), nil
+}
+
+// edgesDepth returns the number of levels of edges with parameters in edges.
+func edgesDepth(edges map[string]QueryParams) int {
+	depth := 0
+	for _, params := range edges {
+		depth = max(depth, 1+edgesDepth(params.Edges))
+	}
+	return depth
+}
+
+func paginationToQueryString(p Pagination) (string, error) {
+	if p.Cursor != "" {
+		return "", fmt.Errorf("pagination cursors are only supported by QueryPage")
+	}
 	paginationStr := ""
 	if p.Limit > 0 {
 		paginationStr += ", " + fmt.Sprintf("first: %d", p.Limit)
@@ -172,34 +677,163 @@ func paginationToQueryString(p Pagination) string {
 	if p.Offset > 0 {
 		paginationStr += ", " + fmt.Sprintf("offset: %d", p.Offset)
 	} else if p.After != "" {
-		paginationStr += ", " + fmt.Sprintf("after: %s", p.After)
+		after, err := strconv.ParseUint(p.After, 0, 64)
+		if err != nil {
+			return "", fmt.Errorf("invalid gid %q to paginate after: %w", p.After, err)
+		}
+		paginationStr += ", " + fmt.Sprintf("after: %#x", after)
 	}
-	if paginationStr == "" {
-		return ""
+	return paginationStr, nil
+}
+
+// sortKeys returns the keys of the sorting, in the order they are applied.
+func (s Sorting) sortKeys() ([]SortKey, error) {
+	if len(s.Keys) != 0 {
+		if s.OrderAscField != "" || s.OrderDescField != "" {
+			return nil, fmt.Errorf("sorting keys can't be set along with the order fields")
+		}
+		return s.Keys, nil
 	}
-	return paginationStr
+
+	keys := []SortKey{{Field: s.OrderAscField}, {Field: s.OrderDescField, Desc: true}}
+	if s.OrderDescFirst {
+		keys[0], keys[1] = keys[1], keys[0]
+	}
+	return slices.DeleteFunc(keys, func(k SortKey) bool {
+		return k.Field == ""
+	}), nil
 }
 
-func sortingToQueryString(typeName string, s Sorting) string {
-	if s.OrderAscField == "" && s.OrderDescField == "" {
-		return ""
+func sortingToQueryString(t reflect.Type, s Sorting, vars *querygen.QueryVars) (string, error) {
+	keys, err := s.sortKeys()
+	if err != nil {
+		return "", err
+	}
+	if len(keys) == 0 {
+		return "", nil
+	}
+
+	parts := make([]string, len(keys))
+	for i, key := range keys {
+		op := "orderasc"
+		if key.Desc {
+			op = "orderdesc"
+		}
+
+		var attr string
+		switch {
+		case key.SimilarTo != nil:
+			attr, err = similarityToQueryVar(t, key, fmt.Sprintf("sort%d", i), vars)
+		case strings.Contains(key.Field, "."):
+			attr, err = sortPathToQueryVar(t, key, fmt.Sprintf("sort%d", i), vars)
+		default:
+			_, err = sortField(t, key.Field)
+			attr = apiutils.GetPredicateName(t.Name(), key.Field)
+		}
+		if err != nil {
+			return "", err
+		}
+		parts[i] = fmt.Sprintf("%s: %s", op, attr)
+	}
+
+	return ", " + strings.Join(parts, ", "), nil
+}
+
+// sortField returns the field of the type with the json name, it must hold values the
+// objects can be sorted by.
+func sortField(t reflect.Type, jsonName string) (reflect.StructField, error) {
+	field, err := filterField(t, jsonName)
+	if err != nil {
+		return field, err
+	}
+	switch field.Type.Kind() {
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32,
+		reflect.Float32, reflect.Float64, reflect.String:
+		return field, nil
 	}
+	if field.Type == reflect.TypeOf(time.Time{}) {
+		return field, nil
+	}
+	return field, fmt.Errorf("field %s of type %s can't be sorted by", jsonName, t.Name())
+}
 
-	var parts []string
-	first, second := s.OrderDescField, s.OrderAscField
-	firstOp, secondOp := "orderdesc", "orderasc"
+// indexedField returns the field of the type with the json name, it must have one of the
+// indexes given by their constraint names.
+func indexedField(t reflect.Type, jsonName string, constraints ...string) (reflect.StructField, error) {
+	field, err := filterField(t, jsonName)
+	if err != nil {
+		return field, err
+	}
+	tagMaps, err := structreflect.GetFieldTags(t)
+	if err != nil {
+		return field, err
+	}
+	if dbTag := tagMaps.JsonToDb[jsonName]; dbTag == nil || !slices.Contains(constraints, dbTag.Constraint) {
+		return field, fmt.Errorf("field %s of type %s has no %s index", jsonName, t.Name(),
+			strings.Join(constraints, " or "))
+	}
+	return field, nil
+}
 
-	if !s.OrderDescFirst {
-		first, second = s.OrderAscField, s.OrderDescField
-		firstOp, secondOp = "orderasc", "orderdesc"
+// similarityToQueryVar adds the variable with the distances of the vectors of the key
+// field to its vector, and returns the attribute sorting by it.
+func similarityToQueryVar(t reflect.Type, key SortKey, name string, vars *querygen.QueryVars) (string, error) {
+	if vars == nil {
+		return "", fmt.Errorf("sorting by similarity is only supported at the root of a query")
+	}
+	if _, err := indexedField(t, key.Field, "vector"); err != nil {
+		return "", err
+	}
+	tagMaps, err := structreflect.GetFieldTags(t)
+	if err != nil {
+		return "", err
 	}
+	vars.AddSimilarity(name, t.Name(), apiutils.GetPredicateName(t.Name(), key.Field),
+		tagMaps.JsonToDb[key.Field].VectorMetric(), key.SimilarTo)
+	return fmt.Sprintf("val(%s)", name), nil
+}
 
-	if first != "" {
-		parts = append(parts, fmt.Sprintf("%s: %s", firstOp, apiutils.GetPredicateName(typeName, first)))
+// sortPathToQueryVar adds the variable with the values of the field at the end of the
+// path of edges of the key, and returns the attribute sorting by it.
+func sortPathToQueryVar(t reflect.Type, key SortKey, name string, vars *querygen.QueryVars) (string, error) {
+	if vars == nil {
+		return "", fmt.Errorf("sorting by the fields of edges is only supported at the root of a query")
 	}
-	if second != "" {
-		parts = append(parts, fmt.Sprintf("%s: %s", secondOp, apiutils.GetPredicateName(typeName, second)))
+	path := strings.Split(key.Field, ".")
+	edges := make([]string, len(path)-1)
+	edgeType := t
+	for i, jsonName := range path[:len(path)-1] {
+		tagMaps, err := structreflect.GetFieldTags(edgeType)
+		if err != nil {
+			return "", err
+		}
+		var next reflect.Type
+		for fieldName, name := range tagMaps.FieldToJson {
+			if name == jsonName {
+				field, _ := edgeType.FieldByName(fieldName)
+				next = structreflect.EdgeType(field.Type)
+				break
+			}
+		}
+		if next == nil {
+			return "", fmt.Errorf("field %s of type %s is not an edge", jsonName, edgeType.Name())
+		}
+		edges[i] = apiutils.GetPredicateName(edgeType.Name(), jsonName)
+		if reverseEdge := tagMaps.JsonToReverseEdge[jsonName]; reverseEdge != "" {
+			edges[i] = "~" + reverseEdge
+		}
+		edgeType = next
 	}
 
-	return ", " + strings.Join(parts, ", ")
+	last := path[len(path)-1]
+	if _, err := sortField(edgeType, last); err != nil {
+		return "", err
+	}
+	aggregate := "min"
+	if key.Desc {
+		aggregate = "max"
+	}
+	vars.AddSortPath(name, t.Name(), edges, apiutils.GetPredicateName(edgeType.Name(), last), aggregate)
+	return fmt.Sprintf("val(%s)", name), nil
 }
@@ -0,0 +1,313 @@
+/*
+ * SPDX-FileCopyrightText: © Hypermode Inc. <hello@hypermode.com>
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package modusdb
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"slices"
+
+	"github.com/dgraph-io/badger/v4"
+	bpb "github.com/dgraph-io/badger/v4/pb"
+	"github.com/hypermodeinc/dgraph/v24/posting"
+	"github.com/hypermodeinc/dgraph/v24/protos/pb"
+	"github.com/hypermodeinc/dgraph/v24/schema"
+	"github.com/hypermodeinc/dgraph/v24/worker"
+	"github.com/hypermodeinc/dgraph/v24/x"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	backupManifestKey = "0-dgraph.modusdb.backup"
+
+	maxPendingRestoreWrites = 16
+)
+
+var (
+	ErrInvalidBackup = errors.New("invalid modusDB backup")
+	ErrOpenTxns      = errors.New("transactions are still open")
+	// ErrDroppedSinceBackup is returned by incremental backups when data, predicates or
+	// types were dropped after sinceTs, a full backup is needed instead.
+	ErrDroppedSinceBackup = errors.New("data was dropped since the previous backup")
+)
+
+// backupManifest is written at the beginning of every backup.
+type backupManifest struct {
+	SinceTs       uint64 `json:"since_ts"`
+	ReadTs        uint64 `json:"read_ts"`
+	AllNamespaces bool   `json:"all_namespaces"`
+	Namespace     uint64 `json:"namespace,omitempty"`
+}
+
+func (m *backupManifest) includes(nsID uint64) bool {
+	return m.AllNamespaces || m.Namespace == nsID
+}
+
+// Backup streams a consistent snapshot of the data to w, along with the zero state.
+// When sinceTs is zero, the backup is a full backup, otherwise only the changes
+// committed after sinceTs are written. The returned timestamp is the one at which
+// the snapshot was taken, it can be passed as sinceTs to the next incremental backup.
+// The backup can optionally be limited to a single namespace.
+// Incremental backups only record the keys written after sinceTs, not the data,
+// predicates, types or namespaces dropped, so they fail with ErrDroppedSinceBackup
+// when any of the namespaces backed up had a drop after sinceTs.
+func (engine *Engine) Backup(ctx context.Context, w io.Writer, sinceTs uint64, nsId ...uint64) (uint64, error) {
+	engine.mutex.RLock()
+	defer engine.mutex.RUnlock()
+
+	if !engine.isOpen.Load() {
+		return 0, ErrClosedEngine
+	}
+	if len(nsId) > 1 {
+		return 0, fmt.Errorf("only one namespace is allowed")
+	}
+
+	manifest := &backupManifest{SinceTs: sinceTs, AllNamespaces: len(nsId) == 0}
+	if !manifest.AllNamespaces {
+		if _, err := engine.getNamespaceWithLock(nsId[0]); err != nil {
+			return 0, err
+		}
+		manifest.Namespace = nsId[0]
+	}
+
+	// keeps the snapshot from being compacted away while it is streamed
+	manifest.ReadTs = engine.o.pin()
+	defer engine.o.unpin(manifest.ReadTs)
+	if sinceTs > manifest.ReadTs {
+		return 0, fmt.Errorf("sinceTs %d is ahead of the latest commit %d", sinceTs, manifest.ReadTs)
+	}
+	if sinceTs != 0 && engine.z.droppedSince(sinceTs, manifest.includes) {
+		return 0, fmt.Errorf("cannot back up the changes since %d: %w", sinceTs, ErrDroppedSinceBackup)
+	}
+
+	data, err := json.Marshal(manifest)
+	if err != nil {
+		return 0, fmt.Errorf("error marshalling backup manifest: %w", err)
+	}
+	if err := writeKVList(w, []*bpb.KV{zeroKV(backupManifestKey, data)}); err != nil {
+		return 0, fmt.Errorf("error writing backup manifest: %w", err)
+	}
+
+	stream := worker.State.Pstore.NewStreamAt(manifest.ReadTs)
+	stream.LogPrefix = "modusDB.Backup"
+	stream.SinceTs = sinceTs
+	stream.ChooseKey = func(item *badger.Item) bool {
+		if ctx.Err() != nil {
+			return false
+		}
+		key := item.Key()
+		// the zero state is written separately, it is not versioned
+		if isZeroStateKey(key) {
+			return false
+		}
+		return manifest.includes(keyNamespace(key))
+	}
+	if _, err := stream.Backup(w, sinceTs); err != nil {
+		return 0, fmt.Errorf("error streaming backup: %w", err)
+	}
+	if err := ctx.Err(); err != nil {
+		return 0, err
+	}
+
+	zs, namespaces := engine.z.snapshot(manifest.includes)
+	zsData, err := proto.Marshal(zs)
+	if err != nil {
+		return 0, fmt.Errorf("error marshalling zero state: %w", err)
+	}
+	nsData, err := json.Marshal(namespaces)
+	if err != nil {
+		return 0, fmt.Errorf("error marshalling namespaces: %w", err)
+	}
+	kvs := []*bpb.KV{zeroKV(zeroStateKey, zsData), zeroKV(namespacesKey, nsData)}
+	if err := writeKVList(w, kvs); err != nil {
+		return 0, fmt.Errorf("error writing zero state: %w", err)
+	}
+
+	return manifest.ReadTs, nil
+}
+
+// Restore loads a backup written by Backup. Restoring a full backup replaces all the
+// data, or all the data of the namespace for a single namespace backup. Incremental
+// backups are applied on top of the existing data, and must be restored in the same
+// order as they were taken, after the full backup they are based on.
+func (engine *Engine) Restore(ctx context.Context, r io.Reader) error {
+	engine.mutex.Lock()
+	defer engine.mutex.Unlock()
+
+	if !engine.isOpen.Load() {
+		return ErrClosedEngine
+	}
+	// the oracle is replaced by the restore, the open transactions would be left
+	// reading dropped data and finishing against an oracle that never tracked them
+	if engine.o.hasOpenTxns() {
+		return fmt.Errorf("cannot restore a backup: %w", ErrOpenTxns)
+	}
+
+	br := bufio.NewReaderSize(r, 16<<10)
+	list, err := readKVList(br)
+	if err != nil {
+		return fmt.Errorf("%w: error reading manifest: %w", ErrInvalidBackup, err)
+	}
+	if len(list.Kv) != 1 || !bytes.Equal(list.Kv[0].Key, x.DataKey(backupManifestKey, zeroStateUID)) {
+		return fmt.Errorf("%w: manifest not found", ErrInvalidBackup)
+	}
+	manifest := &backupManifest{}
+	if err := json.Unmarshal(list.Kv[0].Value, manifest); err != nil {
+		return fmt.Errorf("%w: error unmarshalling manifest: %w", ErrInvalidBackup, err)
+	}
+
+	if !manifest.AllNamespaces && slices.Contains(worker.State.Pstore.BannedNamespaces(), manifest.Namespace) {
+		return fmt.Errorf("namespace %d has been deleted and cannot be restored", manifest.Namespace)
+	}
+	if manifest.SinceTs == 0 {
+		if err := engine.dropForRestore(ctx, manifest); err != nil {
+			return err
+		}
+	}
+
+	var zs *pb.MembershipState
+	namespaces := make(map[uint64]*namespaceMeta)
+	loader := worker.State.Pstore.NewKVLoader(maxPendingRestoreWrites)
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		list, err := readKVList(br)
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return fmt.Errorf("%w: %w", ErrInvalidBackup, err)
+		}
+
+		for _, kv := range list.Kv {
+			switch {
+			case bytes.Equal(kv.Key, x.DataKey(zeroStateKey, zeroStateUID)):
+				zs = &pb.MembershipState{}
+				if err := proto.Unmarshal(kv.Value, zs); err != nil {
+					return fmt.Errorf("%w: error unmarshalling zero state: %w", ErrInvalidBackup, err)
+				}
+			case bytes.Equal(kv.Key, x.DataKey(namespacesKey, zeroStateUID)):
+				if err := json.Unmarshal(kv.Value, &namespaces); err != nil {
+					return fmt.Errorf("%w: error unmarshalling namespaces: %w", ErrInvalidBackup, err)
+				}
+			default:
+				if err := loader.Set(kv); err != nil {
+					return fmt.Errorf("error restoring key: %w", err)
+				}
+			}
+		}
+	}
+	if err := loader.Finish(); err != nil {
+		return fmt.Errorf("error restoring backup: %w", err)
+	}
+	if zs == nil {
+		return fmt.Errorf("%w: zero state not found", ErrInvalidBackup)
+	}
+
+	// a single namespace only needs its own ID to stay leased
+	if !manifest.AllNamespaces {
+		zs.MaxNsID = manifest.Namespace
+	}
+	if err := engine.z.restore(zs, namespaces, manifest.includes); err != nil {
+		return fmt.Errorf("error restoring zero state: %w", err)
+	}
+
+	posting.ResetCache()
+	if err := engine.reset(); err != nil {
+		return fmt.Errorf("error resetting db: %w", err)
+	}
+	return nil
+}
+
+// dropForRestore drops the data that is going to be replaced by a full backup.
+func (engine *Engine) dropForRestore(ctx context.Context, manifest *backupManifest) error {
+	if manifest.AllNamespaces {
+		p := &pb.Proposal{Mutations: &pb.Mutations{
+			GroupId: 1,
+			DropOp:  pb.Mutations_ALL,
+		}}
+		if err := worker.ApplyMutations(ctx, p); err != nil {
+			return fmt.Errorf("error applying mutation: %w", err)
+		}
+		// keeps the leases, so that no timestamp gets reused if the restore fails
+		if err := engine.z.writeState(); err != nil {
+			return fmt.Errorf("error writing zero state: %w", err)
+		}
+		return nil
+	}
+
+	if err := engine.dropDataWithLock(ctx, manifest.Namespace); err != nil {
+		return err
+	}
+
+	// the schema and types of the namespace are restored from the backup as well
+	schema.State().DeletePredsForNs(manifest.Namespace)
+	nsBytes := x.NamespaceToBytes(manifest.Namespace)
+	schemaPrefix := append([]byte{x.ByteSchema}, nsBytes...)
+	typePrefix := append([]byte{x.ByteType}, nsBytes...)
+	if err := worker.State.Pstore.DropPrefix(schemaPrefix, typePrefix); err != nil {
+		return fmt.Errorf("error dropping schema: %w", err)
+	}
+	return nil
+}
+
+// keyNamespace returns the namespace of a badger key, see x.NamespaceOffset.
+func keyNamespace(key []byte) uint64 {
+	if len(key) < x.NamespaceOffset+8 {
+		return 0
+	}
+	return binary.BigEndian.Uint64(key[x.NamespaceOffset:])
+}
+
+func isZeroStateKey(key []byte) bool {
+	return bytes.Equal(key, x.DataKey(zeroStateKey, zeroStateUID)) ||
+		bytes.Equal(key, x.DataKey(namespacesKey, zeroStateUID))
+}
+
+func zeroKV(attr string, value []byte) *bpb.KV {
+	return &bpb.KV{
+		Key:      x.DataKey(attr, zeroStateUID),
+		Value:    value,
+		UserMeta: []byte{posting.BitCompletePosting},
+		Version:  zeroStateTs,
+	}
+}
+
+// writeKVList writes the list in the same format as badger's Stream.Backup.
+func writeKVList(w io.Writer, kvs []*bpb.KV) error {
+	list := &bpb.KVList{Kv: kvs}
+	if err := binary.Write(w, binary.LittleEndian, uint64(proto.Size(list))); err != nil {
+		return err
+	}
+	buf, err := proto.Marshal(list)
+	if err != nil {
+		return err
+	}
+	_, err = w.Write(buf)
+	return err
+}
+
+func readKVList(r io.Reader) (*bpb.KVList, error) {
+	var sz uint64
+	if err := binary.Read(r, binary.LittleEndian, &sz); err != nil {
+		return nil, err
+	}
+	buf := make([]byte, sz)
+	if _, err := io.ReadFull(r, buf); err != nil {
+		return nil, err
+	}
+	list := &bpb.KVList{}
+	if err := proto.Unmarshal(buf, list); err != nil {
+		return nil, err
+	}
+	return list, nil
+}
@@ -0,0 +1,707 @@
+/*
+ * SPDX-FileCopyrightText: © Hypermode Inc. <hello@hypermode.com>
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package modusdb
+
+import (
+	"bufio"
+	"bytes"
+	"container/heap"
+	"context"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"log"
+	"math"
+	"os"
+	"path/filepath"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/dgraph-io/badger/v4"
+	bpb "github.com/dgraph-io/badger/v4/pb"
+	"github.com/dgraph-io/dgo/v240/protos/api"
+	"github.com/dgraph-io/ristretto/v2/z"
+	"github.com/dgryski/go-farm"
+	"github.com/hypermodeinc/dgraph/v24/codec"
+	"github.com/hypermodeinc/dgraph/v24/dql"
+	"github.com/hypermodeinc/dgraph/v24/posting"
+	"github.com/hypermodeinc/dgraph/v24/protos/pb"
+	"github.com/hypermodeinc/dgraph/v24/schema"
+	"github.com/hypermodeinc/dgraph/v24/worker"
+	"github.com/hypermodeinc/dgraph/v24/x"
+	"google.golang.org/protobuf/proto"
+)
+
+const (
+	// bulkMapBufferSize is the approximate size of the map entries kept in memory
+	// before they are sorted and written to a run file.
+	bulkMapBufferSize = 64 << 20
+	// bulkWriteBufferSize is the size of the buffers passed to the stream writer.
+	bulkWriteBufferSize = 64 << 20
+	// lists larger than this are split into multiple parts, as done by Dgraph
+	bulkSplitSize = 1 << 19
+
+	// bulkFlushAttr is written and dropped right away to flush the memtable, see
+	// flushMemtable.
+	bulkFlushAttr = "dgraph.modusdb.bulk.flush"
+
+	bulkDataStream  = 1
+	bulkSplitStream = 2
+)
+
+var ErrNamespaceNotEmpty = errors.New("namespace is not empty")
+
+// BulkLoad loads the schema and the data files into the namespace, which must not
+// have any data yet. The files are read as in LoadData, but instead of committing
+// the N-Quads in transactions, they are sorted into posting lists on disk and written
+// straight into the storage. The indexes, reverse edges and counts are then built once
+// for all the data. It is much faster than Load for large initial loads.
+//
+// Each non-list predicate of a node keeps the last value read, as in mutations. The
+// files are read concurrently unless Concurrency is 1, so when several files set the
+// value, which one is kept is undefined. With Concurrency 1, the files are read one
+// after the other in the order of their paths, and the value of the last one is kept.
+//
+// Progress reports the N-Quads read so far, the summary includes the time taken
+// to write the data and build the indexes. Checkpoints are not supported, a bulk
+// load that fails leaves the namespace without data and can be run again. The
+// engine is locked while the data is written, other operations wait for it.
+func (n *Namespace) BulkLoad(ctx context.Context, schemaPath, dataPath string,
+	opts ...LoadOptions) (*LoadSummary, error) {
+
+	schemaData, err := readSchemaFile(schemaPath)
+	if err != nil {
+		return nil, fmt.Errorf("error reading schema file [%v]: %w", schemaPath, err)
+	}
+
+	summary, err := n.engine.bulkLoad(ctx, n, string(schemaData), dataPath, opts)
+	if err != nil {
+		return nil, fmt.Errorf("error bulk loading data: %w", err)
+	}
+	return summary, nil
+}
+
+func (engine *Engine) bulkLoad(ctx context.Context, ns *Namespace, sch, dataPath string,
+	opts []LoadOptions) (*LoadSummary, error) {
+
+	start := time.Now()
+	ll, err := newLiveLoader(ns, opts)
+	if err != nil {
+		return nil, err
+	}
+	if ll.checkpoint != nil {
+		return nil, fmt.Errorf("checkpoints are not supported by the bulk loader")
+	}
+	if err := engine.checkBulkLoad(ns); err != nil {
+		return nil, err
+	}
+	if err := ns.AlterSchema(ctx, sch); err != nil {
+		return nil, fmt.Errorf("error altering schema: %w", err)
+	}
+
+	if err := os.MkdirAll(x.WorkerConfig.TmpDir, 0700); err != nil {
+		return nil, fmt.Errorf("error creating temp directory: %w", err)
+	}
+	tmpDir, err := os.MkdirTemp(x.WorkerConfig.TmpDir, "bulk_")
+	if err != nil {
+		return nil, fmt.Errorf("error creating temp directory: %w", err)
+	}
+	defer os.RemoveAll(tmpDir)
+
+	bl := &bulkLoader{ns: ns, tmpDir: tmpDir, schema: make(map[string]*pb.SchemaUpdate)}
+	summary, err := ll.run(ctx, dataPath, bl.mapMutation)
+	if err != nil {
+		return nil, err
+	}
+	if err := bl.writeRun(); err != nil {
+		return nil, err
+	}
+
+	log.Printf("writing %d N-Quads from %d map file(s)", summary.NQuads, len(bl.runs))
+	if err := engine.writeBulkLoad(ctx, bl); err != nil {
+		return nil, err
+	}
+
+	summary.Elapsed = time.Since(start)
+	summary.Rate = float64(summary.NQuads) / summary.Elapsed.Seconds()
+	return summary, nil
+}
+
+func (engine *Engine) checkBulkLoad(ns *Namespace) error {
+	engine.mutex.RLock()
+	defer engine.mutex.RUnlock()
+
+	return engine.checkBulkLoadWithLock(ns)
+}
+
+func (engine *Engine) checkBulkLoadWithLock(ns *Namespace) error {
+	if _, err := engine.getNamespaceWithLock(ns.ID()); err != nil {
+		return err
+	}
+	hasData, err := namespaceHasData(ns.ID(), engine.o.readTs())
+	if err != nil {
+		return fmt.Errorf("error reading namespace: %w", err)
+	}
+	if hasData {
+		return ErrNamespaceNotEmpty
+	}
+	return nil
+}
+
+// namespaceHasData returns whether any data has been written into the namespace.
+// The zero state and the checkpoints of the live loader are not data.
+func namespaceHasData(nsID, readTs uint64) (bool, error) {
+	txn := worker.State.Pstore.NewTransactionAt(readTs, false)
+	defer txn.Discard()
+
+	iopts := badger.DefaultIteratorOptions
+	iopts.PrefetchValues = false
+	iopts.Prefix = append([]byte{x.DefaultPrefix}, x.NamespaceToBytes(nsID)...)
+	itr := txn.NewIterator(iopts)
+	defer itr.Close()
+
+	for itr.Rewind(); itr.Valid(); itr.Next() {
+		item := itr.Item()
+		if item.IsDeletedOrExpired() || isZeroStateKey(item.Key()) {
+			continue
+		}
+		pk, err := x.Parse(item.Key())
+		if err != nil {
+			return false, err
+		}
+		if pk.IsData() {
+			return true, nil
+		}
+	}
+	return false, nil
+}
+
+// writeBulkLoad merges the runs of the bulk loader into posting lists, writes them
+// with the stream writer and builds the indexes of the predicates loaded.
+func (engine *Engine) writeBulkLoad(ctx context.Context, bl *bulkLoader) error {
+	engine.mutex.Lock()
+	defer engine.mutex.Unlock()
+
+	if !engine.isOpen.Load() {
+		return ErrClosedEngine
+	}
+	// the namespace may have been written to while the files were read
+	if err := engine.checkBulkLoadWithLock(bl.ns); err != nil {
+		return err
+	}
+
+	// predicates that are not in the schema are created as in mutations
+	if len(bl.schema) > 0 {
+		sc := &schema.ParsedSchema{}
+		for _, su := range bl.schema {
+			sc.Preds = append(sc.Preds, su)
+		}
+		if err := engine.alterSchemaWithParsed(ctx, sc); err != nil {
+			return fmt.Errorf("error altering schema: %w", err)
+		}
+	}
+
+	ts, err := engine.z.nextTs()
+	if err != nil {
+		return err
+	}
+
+	if err := flushMemtable(bl.ns.ID()); err != nil {
+		return fmt.Errorf("error flushing memtable: %w", err)
+	}
+	sw := worker.State.Pstore.NewStreamWriter()
+	if err := sw.PrepareIncremental(); err != nil {
+		sw.Cancel()
+		return fmt.Errorf("error preparing stream writer: %w", err)
+	}
+	attrs, err := bl.reduce(ctx, sw, ts)
+	if err != nil {
+		sw.Cancel()
+		return err
+	}
+	if err := sw.Flush(); err != nil {
+		return fmt.Errorf("error flushing stream writer: %w", err)
+	}
+	posting.ResetCache()
+
+	for _, attr := range attrs {
+		if err := rebuildIndexes(ctx, attr, ts); err != nil {
+			return fmt.Errorf("error building indexes for [%v]: %w", x.ParseAttr(attr), err)
+		}
+	}
+
+	engine.o.commit(ts, nil)
+	return nil
+}
+
+// flushMemtable makes badger flush its memtable by dropping a key written just for it.
+// The stream writer cannot write incrementally while the memtable has data, and badger
+// has no call to flush it: Sync only syncs the write-ahead log and Flatten only compacts
+// the tables already on disk. DropPrefix flushes the memtable before dropping the keys,
+// but returns early when no key has the prefix, hence the key written first.
+func flushMemtable(nsID uint64) error {
+	attr := x.NamespaceAttr(nsID, bulkFlushAttr)
+	txn := worker.State.Pstore.NewTransactionAt(zeroStateTs, true)
+	defer txn.Discard()
+	if err := txn.Set(x.DataKey(attr, zeroStateUID), nil); err != nil {
+		return err
+	}
+	if err := txn.CommitAt(zeroStateTs, nil); err != nil {
+		return err
+	}
+	return worker.State.Pstore.DropPrefix(x.PredicatePrefix(attr))
+}
+
+// rebuildIndexes builds the indexes, reverse edges and counts of the predicate
+// as if they were added to the schema of a predicate without them.
+func rebuildIndexes(ctx context.Context, attr string, ts uint64) error {
+	su, ok := schema.State().Get(ctx, attr)
+	if !ok {
+		return nil
+	}
+	old := proto.Clone(&su).(*pb.SchemaUpdate)
+	old.Directive = pb.SchemaUpdate_NONE
+	old.Tokenizer = nil
+	old.IndexSpecs = nil
+	old.Count = false
+
+	rb := &posting.IndexRebuild{
+		Attr:          attr,
+		StartTs:       ts,
+		OldSchema:     old,
+		CurrentSchema: &su,
+	}
+	if !rb.NeedIndexRebuild() {
+		return nil
+	}
+	return rb.BuildIndexes(ctx)
+}
+
+// bulkLoader is the map and reduce phases of a bulk load. The N-Quads are mapped to
+// entries of the posting lists, which are sorted and written to run files once enough
+// of them are buffered. The runs are then merged into the sorted posting lists.
+type bulkLoader struct {
+	ns     *Namespace
+	tmpDir string
+	// predicates not in the schema, with the schema inferred from the data
+	schema map[string]*pb.SchemaUpdate
+
+	entries []*bulkEntry
+	size    int
+	runs    []string
+
+	// the parts of the split posting lists, sorted into their own runs as they are
+	// produced by the reduce phase
+	splits    []*bulkEntry
+	splitSize int
+	splitRuns []string
+}
+
+type bulkEntry struct {
+	key []byte
+	uid uint64
+	// the marshalled posting, nil if the UID is all that is needed
+	posting []byte
+}
+
+func (e *bulkEntry) less(o *bulkEntry) bool {
+	if c := bytes.Compare(e.key, o.key); c != 0 {
+		return c < 0
+	}
+	return e.uid < o.uid
+}
+
+func (bl *bulkLoader) mapMutation(ctx context.Context, mu *api.Mutation) error {
+	for _, nq := range mu.Set {
+		if err := bl.mapNQuad(ctx, nq); err != nil {
+			return err
+		}
+	}
+	if bl.size >= bulkMapBufferSize {
+		return bl.writeRun()
+	}
+	return nil
+}
+
+func (bl *bulkLoader) mapNQuad(ctx context.Context, nq *api.NQuad) error {
+	nq.Namespace = bl.ns.ID()
+	dnq := dql.NQuad{NQuad: nq}
+
+	sid, err := strconv.ParseUint(nq.Subject, 0, 64)
+	if err != nil {
+		return fmt.Errorf("error parsing subject UID [%v]: %w", nq.Subject, err)
+	}
+	var de *pb.DirectedEdge
+	if nq.ObjectValue == nil {
+		oid, err := strconv.ParseUint(nq.ObjectId, 0, 64)
+		if err != nil {
+			return fmt.Errorf("error parsing object UID [%v]: %w", nq.ObjectId, err)
+		}
+		de = dnq.CreateUidEdge(sid, oid)
+	} else {
+		de, err = dnq.CreateValueEdge(sid)
+		if err != nil {
+			return fmt.Errorf("error creating edge: %w", err)
+		}
+	}
+	de.Attr = x.NamespaceAttr(bl.ns.ID(), de.Attr)
+
+	su := bl.predicateSchema(ctx, de)
+	if err := worker.ValidateAndConvert(de, su); err != nil {
+		return fmt.Errorf("error validating N-Quad for predicate [%v]: %w", nq.Predicate, err)
+	}
+
+	// values are identified in the posting list as done by the posting package, whose
+	// fingerprint of the edges is not exported, with the go-farm fingerprints it uses
+	p := posting.NewPosting(de)
+	if nq.ObjectValue != nil {
+		switch {
+		case len(de.Lang) > 0:
+			p.Uid = farm.Fingerprint64([]byte(de.Lang))
+		case su.List:
+			p.Uid = farm.Fingerprint64(de.Value)
+		default:
+			p.Uid = math.MaxUint64
+		}
+	}
+
+	e := &bulkEntry{key: x.DataKey(de.Attr, sid), uid: p.Uid}
+	if p.PostingType != pb.Posting_REF || len(p.Facets) > 0 {
+		if e.posting, err = proto.Marshal(p); err != nil {
+			return fmt.Errorf("error marshalling posting: %w", err)
+		}
+	}
+	bl.entries = append(bl.entries, e)
+	bl.size += len(e.key) + len(e.posting) + 48
+	return nil
+}
+
+// predicateSchema returns the schema of the predicate of the edge. Predicates not in
+// the schema get the type of their first value, uid predicates are lists.
+func (bl *bulkLoader) predicateSchema(ctx context.Context, de *pb.DirectedEdge) *pb.SchemaUpdate {
+	if su, ok := bl.schema[de.Attr]; ok {
+		return su
+	}
+	if su, ok := schema.State().Get(ctx, de.Attr); ok {
+		return &su
+	}
+	su := &pb.SchemaUpdate{Predicate: de.Attr, ValueType: de.ValueType}
+	if de.ValueType == pb.Posting_UID {
+		su.List = true
+	}
+	bl.schema[de.Attr] = su
+	return su
+}
+
+// writeRun sorts the buffered entries and writes them to a new run file.
+func (bl *bulkLoader) writeRun() error {
+	if len(bl.entries) == 0 {
+		return nil
+	}
+	path := filepath.Join(bl.tmpDir, fmt.Sprintf("map_%06d", len(bl.runs)))
+	if err := writeRunFile(path, bl.entries); err != nil {
+		return fmt.Errorf("error writing map file: %w", err)
+	}
+
+	bl.runs = append(bl.runs, path)
+	bl.entries = nil
+	bl.size = 0
+	return nil
+}
+
+// writeSplitRun sorts the buffered parts of split lists and writes them to a new run
+// file, the KVs are kept marshalled as the postings of the entries.
+func (bl *bulkLoader) writeSplitRun() error {
+	if len(bl.splits) == 0 {
+		return nil
+	}
+	path := filepath.Join(bl.tmpDir, fmt.Sprintf("split_%06d", len(bl.splitRuns)))
+	if err := writeRunFile(path, bl.splits); err != nil {
+		return fmt.Errorf("error writing split file: %w", err)
+	}
+
+	bl.splitRuns = append(bl.splitRuns, path)
+	bl.splits = nil
+	bl.splitSize = 0
+	return nil
+}
+
+func (bl *bulkLoader) addSplits(kvs []*bpb.KV) error {
+	for _, kv := range kvs {
+		data, err := proto.Marshal(kv)
+		if err != nil {
+			return fmt.Errorf("error marshalling split list: %w", err)
+		}
+		bl.splits = append(bl.splits, &bulkEntry{key: kv.Key, posting: data})
+		bl.splitSize += len(kv.Key) + len(data) + 48
+	}
+	if bl.splitSize >= bulkMapBufferSize {
+		return bl.writeSplitRun()
+	}
+	return nil
+}
+
+// writeRunFile sorts the entries and writes them to the file.
+func writeRunFile(path string, entries []*bulkEntry) error {
+	// the sort is stable so that the last value of a predicate wins, as in mutations
+	sort.SliceStable(entries, func(i, j int) bool {
+		return entries[i].less(entries[j])
+	})
+
+	return writeExportFile(path, false, func(w io.Writer) error {
+		var buf []byte
+		for _, e := range entries {
+			buf = binary.AppendUvarint(buf[:0], uint64(len(e.key)))
+			buf = append(buf, e.key...)
+			buf = binary.AppendUvarint(buf, e.uid)
+			buf = binary.AppendUvarint(buf, uint64(len(e.posting)))
+			buf = append(buf, e.posting...)
+			if _, err := w.Write(buf); err != nil {
+				return err
+			}
+		}
+		return nil
+	})
+}
+
+// mergeRuns calls fn with the entries of the run files in order.
+func mergeRuns(ctx context.Context, paths []string, fn func(e *bulkEntry) error) error {
+	h := make(runHeap, 0, len(paths))
+	defer func() {
+		for _, r := range h {
+			r.fd.Close()
+		}
+	}()
+	for i, path := range paths {
+		fd, err := os.Open(path)
+		if err != nil {
+			return fmt.Errorf("error opening run file: %w", err)
+		}
+		r := &mapRun{idx: i, fd: fd, rd: bufio.NewReaderSize(fd, 1<<20)}
+		h = append(h, r)
+		if err := r.next(); err != nil {
+			return err
+		}
+		if r.cur == nil {
+			h = h[:len(h)-1]
+			fd.Close()
+		}
+	}
+	heap.Init(&h)
+
+	for h.Len() > 0 {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
+		r := h[0]
+		if err := fn(r.cur); err != nil {
+			return err
+		}
+
+		if err := r.next(); err != nil {
+			return err
+		}
+		if r.cur == nil {
+			heap.Pop(&h)
+			r.fd.Close()
+		} else {
+			heap.Fix(&h, 0)
+		}
+	}
+	return nil
+}
+
+// reduce merges the runs and writes the posting lists with the stream writer at ts.
+// It returns the predicates written.
+func (bl *bulkLoader) reduce(ctx context.Context, sw *badger.StreamWriter, ts uint64) ([]string, error) {
+	buf := z.NewBuffer(bulkWriteBufferSize, "modusDB.BulkLoad")
+	defer func() { _ = buf.Release() }()
+	write := func(kv *bpb.KV, streamId uint32) error {
+		kv.StreamId = streamId
+		badger.KVToBuffer(kv, buf)
+		if buf.LenNoPadding() >= bulkWriteBufferSize {
+			if err := sw.Write(buf); err != nil {
+				return fmt.Errorf("error writing posting lists: %w", err)
+			}
+			buf.Reset()
+		}
+		return nil
+	}
+
+	var attrs []string
+	var group []*bulkEntry
+	writeGroup := func() error {
+		if len(group) == 0 {
+			return nil
+		}
+		pk, err := x.Parse(group[0].key)
+		if err != nil {
+			return fmt.Errorf("error parsing key: %w", err)
+		}
+		if len(attrs) == 0 || attrs[len(attrs)-1] != pk.Attr {
+			attrs = append(attrs, pk.Attr)
+		}
+		kvs, err := toKVs(ctx, pk, group, ts)
+		if err != nil {
+			return err
+		}
+		if err := write(kvs[0], bulkDataStream); err != nil {
+			return err
+		}
+		if err := bl.addSplits(kvs[1:]); err != nil {
+			return err
+		}
+		group = group[:0]
+		return nil
+	}
+
+	if err := mergeRuns(ctx, bl.runs, func(e *bulkEntry) error {
+		if len(group) > 0 && !bytes.Equal(group[0].key, e.key) {
+			if err := writeGroup(); err != nil {
+				return err
+			}
+		}
+		group = append(group, e)
+		return nil
+	}); err != nil {
+		return nil, err
+	}
+	if err := writeGroup(); err != nil {
+		return nil, err
+	}
+
+	// the parts of split lists have a different prefix, they are written to their own
+	// stream, which has to be sorted as well
+	if err := bl.writeSplitRun(); err != nil {
+		return nil, err
+	}
+	if err := mergeRuns(ctx, bl.splitRuns, func(e *bulkEntry) error {
+		kv := &bpb.KV{}
+		if err := proto.Unmarshal(e.posting, kv); err != nil {
+			return fmt.Errorf("error unmarshalling split list: %w", err)
+		}
+		return write(kv, bulkSplitStream)
+	}); err != nil {
+		return nil, err
+	}
+
+	if err := sw.Write(buf); err != nil {
+		return nil, fmt.Errorf("error writing posting lists: %w", err)
+	}
+	return attrs, nil
+}
+
+// toKVs builds the posting list of the entries of a key, sorted by UID. The first KV
+// is the posting list, followed by its parts if it was split.
+func toKVs(ctx context.Context, pk x.ParsedKey, entries []*bulkEntry, ts uint64) ([]*bpb.KV, error) {
+	enc := codec.Encoder{BlockSize: 256}
+	pl := &pb.PostingList{}
+	numUids := 0
+	for i, e := range entries {
+		// the last entry of a UID wins
+		if i+1 < len(entries) && entries[i+1].uid == e.uid {
+			continue
+		}
+		enc.Add(e.uid)
+		numUids++
+		if len(e.posting) > 0 {
+			p := &pb.Posting{}
+			if err := proto.Unmarshal(e.posting, p); err != nil {
+				return nil, fmt.Errorf("error unmarshalling posting: %w", err)
+			}
+			pl.Postings = append(pl.Postings, p)
+		}
+	}
+	pl.Pack = enc.Done()
+
+	if su, ok := schema.State().Get(ctx, pk.Attr); ok && su.ValueType == pb.Posting_UID && !su.List && numUids > 1 {
+		codec.FreePack(pl.Pack)
+		return nil, fmt.Errorf("predicate [%v] is not a list but UID %#x has %d values",
+			x.ParseAttr(pk.Attr), pk.Uid, numUids)
+	}
+
+	key := entries[0].key
+	if proto.Size(pl) > bulkSplitSize && len(pl.Pack.Blocks) > 1 {
+		// the list takes over the pack, which is released by Rollup. The rollup is done
+		// at MaxUint64 so that the parts keep ts as their version.
+		l := posting.NewList(key, pl, ts)
+		return l.Rollup(nil, math.MaxUint64)
+	}
+
+	kv := posting.MarshalPostingList(pl, nil)
+	codec.FreePack(pl.Pack)
+	kv.Key = key
+	kv.Version = ts
+	return []*bpb.KV{kv}, nil
+}
+
+// mapRun reads the entries of a run file in order.
+type mapRun struct {
+	idx int
+	fd  *os.File
+	rd  *bufio.Reader
+	cur *bulkEntry
+}
+
+// next reads the next entry into cur, which is nil at the end of the file.
+func (r *mapRun) next() error {
+	r.cur = nil
+	keyLen, err := binary.ReadUvarint(r.rd)
+	if err == io.EOF {
+		return nil
+	} else if err != nil {
+		return fmt.Errorf("error reading map file: %w", err)
+	}
+
+	e := &bulkEntry{key: make([]byte, keyLen)}
+	if _, err := io.ReadFull(r.rd, e.key); err != nil {
+		return fmt.Errorf("error reading map file: %w", err)
+	}
+	if e.uid, err = binary.ReadUvarint(r.rd); err != nil {
+		return fmt.Errorf("error reading map file: %w", err)
+	}
+	postingLen, err := binary.ReadUvarint(r.rd)
+	if err != nil {
+		return fmt.Errorf("error reading map file: %w", err)
+	}
+	if postingLen > 0 {
+		e.posting = make([]byte, postingLen)
+		if _, err := io.ReadFull(r.rd, e.posting); err != nil {
+			return fmt.Errorf("error reading map file: %w", err)
+		}
+	}
+	r.cur = e
+	return nil
+}
+
+// runHeap orders the runs by their current entry. Equal entries are taken from the
+// earlier runs first, so that the entries of a key keep the order they were read in.
+type runHeap []*mapRun
+
+func (h runHeap) Len() int { return len(h) }
+
+func (h runHeap) Less(i, j int) bool {
+	if h[i].cur.less(h[j].cur) {
+		return true
+	}
+	if h[j].cur.less(h[i].cur) {
+		return false
+	}
+	return h[i].idx < h[j].idx
+}
+
+func (h runHeap) Swap(i, j int) { h[i], h[j] = h[j], h[i] }
+
+func (h *runHeap) Push(v any) { *h = append(*h, v.(*mapRun)) }
+
+func (h *runHeap) Pop() any {
+	old := *h
+	r := old[len(old)-1]
+	*h = old[:len(old)-1]
+	return r
+}
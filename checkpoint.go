@@ -0,0 +1,125 @@
+/*
+ * SPDX-FileCopyrightText: © Hypermode Inc. <hello@hypermode.com>
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package modusdb
+
+import (
+	"encoding/binary"
+	"fmt"
+	"math"
+
+	"github.com/dgraph-io/badger/v4"
+	"github.com/hypermodeinc/dgraph/v24/worker"
+	"github.com/hypermodeinc/dgraph/v24/x"
+)
+
+const (
+	// the checkpoints of the loads are stored as index keys of these predicates in
+	// the namespace being loaded, so that they are dropped along with its data
+	loadXidAttr    = "dgraph.modusdb.load.xid"
+	loadOffsetAttr = "dgraph.modusdb.load.offset"
+
+	// fileLoaded is the offset of the files that were loaded completely
+	fileLoaded = math.MaxInt64
+)
+
+// loadCheckpoint persists the progress of a resumable load, see LoadOptions.Checkpoint.
+type loadCheckpoint struct {
+	ns   uint64
+	name string
+}
+
+func (c *loadCheckpoint) key(attr, term string) []byte {
+	return x.IndexKey(x.NamespaceAttr(c.ns, attr), c.name+"\x00"+term)
+}
+
+func (c *loadCheckpoint) get(attr, term string) (uint64, bool, error) {
+	txn := worker.State.Pstore.NewTransactionAt(zeroStateTs, false)
+	defer txn.Discard()
+
+	item, err := txn.Get(c.key(attr, term))
+	if err == badger.ErrKeyNotFound {
+		return 0, false, nil
+	} else if err != nil {
+		return 0, false, err
+	}
+
+	var val uint64
+	err = item.Value(func(v []byte) error {
+		if len(v) != 8 {
+			return fmt.Errorf("invalid checkpoint value of length %d", len(v))
+		}
+		val = binary.BigEndian.Uint64(v)
+		return nil
+	})
+	return val, err == nil, err
+}
+
+// blankNodes returns the UIDs of the blank nodes persisted by the previous runs of the
+// load, keyed like liveLoader.blankNodes.
+func (c *loadCheckpoint) blankNodes() (map[string]string, error) {
+	txn := worker.State.Pstore.NewTransactionAt(zeroStateTs, false)
+	defer txn.Discard()
+
+	prefix := c.key(loadXidAttr, "")
+	itr := txn.NewIterator(badger.IteratorOptions{Prefix: prefix, PrefetchValues: true})
+	defer itr.Close()
+
+	uids := make(map[string]string)
+	for itr.Rewind(); itr.Valid(); itr.Next() {
+		item := itr.Item()
+		err := item.Value(func(v []byte) error {
+			if len(v) != 8 {
+				return fmt.Errorf("invalid checkpoint value of length %d", len(v))
+			}
+			uids[string(item.Key()[len(prefix):])] = fmt.Sprintf("%#x", binary.BigEndian.Uint64(v))
+			return nil
+		})
+		if err != nil {
+			return nil, err
+		}
+	}
+	return uids, nil
+}
+
+// write persists the UIDs of new blank nodes and the offsets the files are loaded up to
+// in a single write.
+func (c *loadCheckpoint) write(uids map[string]uint64, offsets map[string]int64) error {
+	txn := worker.State.Pstore.NewTransactionAt(zeroStateTs, true)
+	defer txn.Discard()
+
+	for key, uid := range uids {
+		if err := txn.Set(c.key(loadXidAttr, key), binary.BigEndian.AppendUint64(nil, uid)); err != nil {
+			return err
+		}
+	}
+	for file, offset := range offsets {
+		if err := txn.Set(c.key(loadOffsetAttr, file), binary.BigEndian.AppendUint64(nil, uint64(offset))); err != nil {
+			return err
+		}
+	}
+	return txn.CommitAt(zeroStateTs, nil)
+}
+
+// DeleteLoadCheckpoint deletes the checkpoint persisted by the loads run with
+// LoadOptions.Checkpoint set to name. The data loaded is not affected, but running
+// the load again loads all the files again, with new UIDs.
+func (ns *Namespace) DeleteLoadCheckpoint(name string) error {
+	ns.engine.mutex.RLock()
+	defer ns.engine.mutex.RUnlock()
+
+	if !ns.engine.isOpen.Load() {
+		return ErrClosedEngine
+	}
+	if !ns.engine.z.namespaceExists(ns.ID()) {
+		return ErrNonExistentDB
+	}
+
+	c := &loadCheckpoint{ns: ns.ID(), name: name}
+	if err := worker.State.Pstore.DropPrefix(c.key(loadXidAttr, ""), c.key(loadOffsetAttr, "")); err != nil {
+		return fmt.Errorf("error deleting load checkpoint: %w", err)
+	}
+	return nil
+}
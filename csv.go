@@ -0,0 +1,214 @@
+/*
+ * SPDX-FileCopyrightText: © Hypermode Inc. <hello@hypermode.com>
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package modusdb
+
+import (
+	"context"
+	"encoding/csv"
+	"fmt"
+	"io"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/dgraph-io/dgo/v240/protos/api"
+	"github.com/hypermodeinc/dgraph/v24/filestore"
+	"github.com/hypermodeinc/dgraph/v24/types"
+)
+
+// CSVValueType is the type of the values of a CSV column.
+type CSVValueType string
+
+const (
+	CSVString   CSVValueType = "string"
+	CSVInt      CSVValueType = "int"
+	CSVFloat    CSVValueType = "float"
+	CSVBool     CSVValueType = "bool"
+	CSVDateTime CSVValueType = "datetime"
+)
+
+// CSVMapping describes how the rows of a CSV file are turned into nodes. The first
+// row of the file must be a header with the names of the columns.
+type CSVMapping struct {
+	// Subject is the column holding the key of the row, unique within the file.
+	// Rows of other files refer to the row using this key.
+	Subject string
+	// Type is set as the dgraph.type of every row, if not empty.
+	Type string
+	// Columns maps the column names to predicates. When empty, every column other
+	// than the subject is loaded as a string predicate with the name of the column.
+	// Columns not in a non-empty map are skipped.
+	Columns map[string]CSVColumn
+}
+
+// CSVColumn maps a column of a CSV file to a predicate.
+type CSVColumn struct {
+	Predicate string
+	// Type of the values, defaults to CSVString. Ignored for edges.
+	Type CSVValueType
+	// Ref is the name of the CSV file whose rows the column refers to, which makes
+	// the column an edge to the row with the same key in the subject column of Ref.
+	Ref string
+}
+
+// csvFileName returns the name of a CSV file, used as key of LoadOptions.CSV
+// and in CSVColumn.Ref, i.e. the base name without the .csv or .csv.gz extension.
+func csvFileName(filename string) string {
+	name := filepath.Base(filename)
+	name = strings.TrimSuffix(name, ".gz")
+	return strings.TrimSuffix(name, ".csv")
+}
+
+func isCSVFile(filename string) bool {
+	return strings.HasSuffix(filename, ".csv") || strings.HasSuffix(filename, ".csv.gz")
+}
+
+// csvKey returns the blank node used for the row with the given key in the named file,
+// so that edges from other files resolve to the same UID.
+func csvKey(name, key string) string {
+	return fmt.Sprintf("_:csv.%s.%s", name, key)
+}
+
+// processCSVFile loads the rows of the file after the given offset, which is
+// tracked at row boundaries using csv.Reader.InputOffset.
+func (l *liveLoader) processCSVFile(ctx context.Context, fs filestore.FileStore,
+	filename string, offset int64, nqch chan *loadBatch) error {
+
+	name := csvFileName(filename)
+	mapping, ok := l.opts.CSV[name]
+	if !ok {
+		return fmt.Errorf("no CSV mapping found for [%v]", filename)
+	}
+
+	rd, cleanup := fs.ChunkReader(filename, nil)
+	defer cleanup()
+
+	cr := csv.NewReader(rd)
+	cr.ReuseRecord = true
+	header, err := cr.Read()
+	if err != nil {
+		return fmt.Errorf("error reading CSV header of [%v]: %w", filename, err)
+	}
+	header = append([]string(nil), header...)
+
+	subjectIdx := -1
+	columns := make([]*CSVColumn, len(header))
+	for i, col := range header {
+		if col == mapping.Subject {
+			subjectIdx = i
+			continue
+		}
+		if len(mapping.Columns) == 0 {
+			columns[i] = &CSVColumn{Predicate: col}
+		} else if c, ok := mapping.Columns[col]; ok {
+			columns[i] = &c
+		}
+	}
+	if subjectIdx < 0 {
+		return fmt.Errorf("subject column [%v] not found in [%v]", mapping.Subject, filename)
+	}
+	for col, c := range mapping.Columns {
+		if c.Predicate == "" {
+			return fmt.Errorf("no predicate for column [%v] of [%v]", col, filename)
+		}
+		if c.Ref != "" {
+			if _, ok := l.opts.CSV[c.Ref]; !ok {
+				return fmt.Errorf("column [%v] of [%v] refers to unknown CSV file [%v]", col, filename, c.Ref)
+			}
+		}
+	}
+
+	batchSize := l.opts.BatchSize
+	batch := make([]*api.NQuad, 0, batchSize)
+	for {
+		record, err := cr.Read()
+		if err == io.EOF {
+			break
+		} else if err != nil {
+			return fmt.Errorf("error reading [%v]: %w", filename, err)
+		}
+		// skips the rows loaded by a previous run
+		if cr.InputOffset() <= offset {
+			continue
+		}
+		line, _ := cr.FieldPos(0)
+
+		key := record[subjectIdx]
+		if key == "" {
+			return fmt.Errorf("empty subject in [%v] line %d", filename, line)
+		}
+		subject := csvKey(name, key)
+
+		if mapping.Type != "" {
+			batch = append(batch, &api.NQuad{
+				Subject:     subject,
+				Predicate:   "dgraph.type",
+				ObjectValue: &api.Value{Val: &api.Value_StrVal{StrVal: mapping.Type}},
+			})
+		}
+		for i, c := range columns {
+			if c == nil || record[i] == "" {
+				continue
+			}
+			nq := &api.NQuad{Subject: subject, Predicate: c.Predicate}
+			if c.Ref != "" {
+				nq.ObjectId = csvKey(c.Ref, record[i])
+			} else {
+				nq.ObjectValue, err = csvValue(c.Type, record[i])
+				if err != nil {
+					return fmt.Errorf("error parsing column [%v] in [%v] line %d: %w",
+						header[i], filename, line, err)
+				}
+			}
+			batch = append(batch, nq)
+		}
+
+		if len(batch) >= batchSize {
+			if err := l.send(ctx, nqch, batch, filename, cr.InputOffset()); err != nil {
+				return err
+			}
+			batch = make([]*api.NQuad, 0, batchSize)
+		}
+	}
+	return l.send(ctx, nqch, batch, filename, fileLoaded)
+}
+
+func csvValue(typ CSVValueType, val string) (*api.Value, error) {
+	switch typ {
+	case "", CSVString:
+		return &api.Value{Val: &api.Value_StrVal{StrVal: val}}, nil
+	case CSVInt:
+		i, err := strconv.ParseInt(val, 10, 64)
+		if err != nil {
+			return nil, err
+		}
+		return &api.Value{Val: &api.Value_IntVal{IntVal: i}}, nil
+	case CSVFloat:
+		f, err := strconv.ParseFloat(val, 64)
+		if err != nil {
+			return nil, err
+		}
+		return &api.Value{Val: &api.Value_DoubleVal{DoubleVal: f}}, nil
+	case CSVBool:
+		b, err := strconv.ParseBool(val)
+		if err != nil {
+			return nil, err
+		}
+		return &api.Value{Val: &api.Value_BoolVal{BoolVal: b}}, nil
+	case CSVDateTime:
+		t, err := types.ParseTime(val)
+		if err != nil {
+			return nil, err
+		}
+		b, err := t.MarshalBinary()
+		if err != nil {
+			return nil, err
+		}
+		return &api.Value{Val: &api.Value_DatetimeVal{DatetimeVal: b}}, nil
+	default:
+		return nil, fmt.Errorf("unknown CSV value type [%v]", typ)
+	}
+}
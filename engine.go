@@ -13,18 +13,18 @@ import (
 	"strconv"
 	"sync"
 	"sync/atomic"
+	"time"
 
 	"github.com/dgraph-io/badger/v4"
 	"github.com/dgraph-io/dgo/v240/protos/api"
 	"github.com/dgraph-io/ristretto/v2/z"
-	"github.com/hypermodeinc/dgraph/v24/dql"
 	"github.com/hypermodeinc/dgraph/v24/edgraph"
 	"github.com/hypermodeinc/dgraph/v24/posting"
 	"github.com/hypermodeinc/dgraph/v24/protos/pb"
-	"github.com/hypermodeinc/dgraph/v24/query"
 	"github.com/hypermodeinc/dgraph/v24/schema"
 	"github.com/hypermodeinc/dgraph/v24/worker"
 	"github.com/hypermodeinc/dgraph/v24/x"
+	"google.golang.org/protobuf/proto"
 )
 
 var (
@@ -35,15 +35,29 @@ var (
 	ErrEmptyDataDir  = errors.New("data directory is required")
 	ErrClosedEngine  = errors.New("modusDB engine is closed")
 	ErrNonExistentDB = errors.New("namespace does not exist")
+
+	ErrDeleteDefaultNamespace = errors.New("default namespace cannot be deleted")
+	ErrNamespaceNameExists    = errors.New("namespace with the same name already exists")
+	ErrEmptyNamespaceName     = errors.New("namespace name cannot be empty")
 )
 
 // Engine is an instance of modusDB.
-// For now, we only support one instance of modusDB per process.
+// For now, we only support one instance of modusDB per process. The embedded Dgraph
+// packages keep the storage, schema and caches in global state, which cannot be
+// isolated between engines. Use a separate Namespace for each independent set of data.
 type Engine struct {
+	// mutex is held for writing only by the operations that replace the whole state of
+	// the engine, such as DropAll and Close. Queries and transactions hold it for reading
+	// and run concurrently, writes are isolated from each other through the oracle.
 	mutex  sync.RWMutex
 	isOpen atomic.Bool
 
+	// commitMutex serializes commits and schema changes, so that the read
+	// timestamp only moves past the writes that have been fully applied.
+	commitMutex sync.Mutex
+
 	z *zero
+	o *oracle
 
 	// points to default / 0 / galaxy namespace
 	db0 *Namespace
@@ -90,7 +104,10 @@ func NewEngine(conf Config) (*Engine, error) {
 	return engine, nil
 }
 
-func (engine *Engine) CreateNamespace() (*Namespace, error) {
+// CreateNamespace creates a new namespace. The namespace can optionally be given
+// a name, unique among the namespaces, and labels using WithNamespaceName and
+// WithNamespaceLabels. Both are stored along with the zero state.
+func (engine *Engine) CreateNamespace(opts ...NamespaceOption) (*Namespace, error) {
 	engine.mutex.RLock()
 	defer engine.mutex.RUnlock()
 
@@ -98,11 +115,16 @@ func (engine *Engine) CreateNamespace() (*Namespace, error) {
 		return nil, ErrClosedEngine
 	}
 
+	meta := &namespaceMeta{}
+	for _, opt := range opts {
+		opt(meta)
+	}
+
 	startTs, err := engine.z.nextTs()
 	if err != nil {
 		return nil, err
 	}
-	nsID, err := engine.z.nextNamespace()
+	nsID, err := engine.z.nextNamespace(meta)
 	if err != nil {
 		return nil, err
 	}
@@ -129,20 +151,92 @@ func (engine *Engine) getNamespaceWithLock(nsID uint64) (*Namespace, error) {
 		return nil, ErrClosedEngine
 	}
 
-	if nsID > engine.z.lastNamespace {
+	if !engine.z.namespaceExists(nsID) {
 		return nil, ErrNonExistentDB
 	}
 
-	// TODO: when delete namespace is implemented, check if the namespace exists
+	return &Namespace{id: nsID, engine: engine}, nil
+}
+
+// GetNamespaceByName returns the namespace with the given name.
+func (engine *Engine) GetNamespaceByName(name string) (*Namespace, error) {
+	engine.mutex.RLock()
+	defer engine.mutex.RUnlock()
+
+	if !engine.isOpen.Load() {
+		return nil, ErrClosedEngine
+	}
 
+	nsID, ok := engine.z.namespaceByName(name)
+	if !ok {
+		return nil, ErrNonExistentDB
+	}
 	return &Namespace{id: nsID, engine: engine}, nil
 }
 
+func (engine *Engine) renameNamespace(ns *Namespace, name string) error {
+	engine.mutex.RLock()
+	defer engine.mutex.RUnlock()
+
+	if name == "" {
+		return ErrEmptyNamespaceName
+	}
+	if _, err := engine.getNamespaceWithLock(ns.ID()); err != nil {
+		return err
+	}
+	return engine.z.renameNamespace(ns.ID(), name)
+}
+
+// ListNamespaces returns all the namespaces that have not been deleted,
+// including the default namespace, ordered by their IDs.
+func (engine *Engine) ListNamespaces() ([]*Namespace, error) {
+	engine.mutex.RLock()
+	defer engine.mutex.RUnlock()
+
+	if !engine.isOpen.Load() {
+		return nil, ErrClosedEngine
+	}
+
+	nsIDs := engine.z.liveNamespaces()
+	namespaces := make([]*Namespace, 0, len(nsIDs))
+	for _, nsID := range nsIDs {
+		namespaces = append(namespaces, &Namespace{id: nsID, engine: engine})
+	}
+	return namespaces, nil
+}
+
+// DeleteNamespace drops all the predicates, types and data of the namespace and
+// records it as deleted. The ID of a deleted namespace is never reused.
+func (engine *Engine) DeleteNamespace(ctx context.Context, nsID uint64) error {
+	engine.mutex.Lock()
+	defer engine.mutex.Unlock()
+
+	if nsID == 0 {
+		return ErrDeleteDefaultNamespace
+	}
+	if _, err := engine.getNamespaceWithLock(nsID); err != nil {
+		return err
+	}
+
+	if err := engine.dropDataWithLock(ctx, nsID); err != nil {
+		return err
+	}
+	if err := engine.recordDrop(nsID); err != nil {
+		return err
+	}
+
+	// bans the namespace in badger and removes its predicates and types from the schema
+	if err := posting.DeleteNamespace(nsID); err != nil {
+		return fmt.Errorf("error deleting namespace: %w", err)
+	}
+	return engine.z.deleteNamespace(nsID)
+}
+
 func (engine *Engine) GetDefaultNamespace() *Namespace {
 	return engine.db0
 }
 
-// DropAll drops all the data and schema in the modusDB instance.
+// DropAll drops all the data and schema in the modusDB instance, the namespaces are kept.
 func (engine *Engine) DropAll(ctx context.Context) error {
 	engine.mutex.Lock()
 	defer engine.mutex.Unlock()
@@ -158,12 +252,15 @@ func (engine *Engine) DropAll(ctx context.Context) error {
 	if err := worker.ApplyMutations(ctx, p); err != nil {
 		return fmt.Errorf("error applying mutation: %w", err)
 	}
+	// keeps the leases and the namespaces, so that the timestamps keep growing past
+	// the ones of the backups taken before the drop
+	if err := engine.z.writeState(); err != nil {
+		return fmt.Errorf("error writing zero state: %w", err)
+	}
 	if err := engine.reset(); err != nil {
 		return fmt.Errorf("error resetting db: %w", err)
 	}
-
-	// TODO: insert drop record
-	return nil
+	return engine.recordDrop(engine.z.liveNamespaces()...)
 }
 
 func (engine *Engine) dropData(ctx context.Context, ns *Namespace) error {
@@ -174,29 +271,114 @@ func (engine *Engine) dropData(ctx context.Context, ns *Namespace) error {
 		return ErrClosedEngine
 	}
 
+	if err := engine.dropDataWithLock(ctx, ns.ID()); err != nil {
+		return err
+	}
+	return engine.recordDrop(ns.ID())
+}
+
+// recordDrop records a drop in the namespaces at a new timestamp, so that the
+// incremental backups since an earlier timestamp are refused. The timestamp is
+// committed, so that the backups taken from then on are past the drop.
+func (engine *Engine) recordDrop(nsIDs ...uint64) error {
+	ts, err := engine.z.nextTs()
+	if err != nil {
+		return err
+	}
+	if err := engine.z.recordDrop(ts, nsIDs...); err != nil {
+		return err
+	}
+	engine.o.commit(ts, nil)
+	return nil
+}
+
+func (engine *Engine) dropDataWithLock(ctx context.Context, nsID uint64) error {
 	p := &pb.Proposal{Mutations: &pb.Mutations{
 		GroupId:   1,
 		DropOp:    pb.Mutations_DATA,
-		DropValue: strconv.FormatUint(ns.ID(), 10),
+		DropValue: strconv.FormatUint(nsID, 10),
 	}}
 
 	if err := worker.ApplyMutations(ctx, p); err != nil {
 		return fmt.Errorf("error applying mutation: %w", err)
 	}
 
-	// TODO: insert drop record
-	// TODO: should we reset back the timestamp as well?
+	// the zero state is stored in the default namespace, write it back
+	if nsID == 0 {
+		if err := engine.z.writeState(); err != nil {
+			return fmt.Errorf("error writing zero state: %w", err)
+		}
+	}
 	return nil
 }
 
+func (engine *Engine) dropPredicate(ctx context.Context, ns *Namespace, pred string) error {
+	attr := x.NamespaceAttr(ns.ID(), pred)
+	if x.IsPreDefinedPredicate(attr) {
+		return fmt.Errorf("predicate [%v] is pre-defined and cannot be dropped", pred)
+	}
+
+	// the same edge Dgraph uses for DropAttr, the whole predicate is deleted
+	edge := &pb.DirectedEdge{
+		Attr:      attr,
+		Namespace: ns.ID(),
+		Value:     []byte(x.Star),
+		Op:        pb.DirectedEdge_DEL,
+	}
+	return engine.applyDropOp(ctx, ns, &pb.Mutations{Edges: []*pb.DirectedEdge{edge}})
+}
+
+func (engine *Engine) dropType(ctx context.Context, ns *Namespace, typeName string) error {
+	typ := x.NamespaceAttr(ns.ID(), typeName)
+	if x.IsPreDefinedType(typ) {
+		return fmt.Errorf("type [%v] is pre-defined and cannot be dropped", typeName)
+	}
+	return engine.applyDropOp(ctx, ns, &pb.Mutations{DropOp: pb.Mutations_TYPE, DropValue: typ})
+}
+
+// applyDropOp applies a mutation dropping part of the schema of the namespace
+// the same way as schema changes are applied.
+func (engine *Engine) applyDropOp(ctx context.Context, ns *Namespace, m *pb.Mutations) error {
+	engine.mutex.RLock()
+	defer engine.mutex.RUnlock()
+
+	if !engine.isOpen.Load() {
+		return ErrClosedEngine
+	}
+	if !engine.z.namespaceExists(ns.ID()) {
+		return ErrNonExistentDB
+	}
+
+	engine.commitMutex.Lock()
+	defer engine.commitMutex.Unlock()
+
+	startTs, err := engine.z.nextTs()
+	if err != nil {
+		return err
+	}
+
+	m.GroupId = 1
+	m.StartTs = startTs
+	if err := worker.ApplyMutations(ctx, &pb.Proposal{Mutations: m, StartTs: startTs}); err != nil {
+		return fmt.Errorf("error applying mutation: %w", err)
+	}
+
+	engine.o.commit(startTs, nil)
+	return engine.z.recordDrop(startTs, ns.ID())
+}
+
 func (engine *Engine) alterSchema(ctx context.Context, ns *Namespace, sch string) error {
-	engine.mutex.Lock()
-	defer engine.mutex.Unlock()
+	engine.mutex.RLock()
+	defer engine.mutex.RUnlock()
 
 	if !engine.isOpen.Load() {
 		return ErrClosedEngine
 	}
 
+	if !engine.z.namespaceExists(ns.ID()) {
+		return ErrNonExistentDB
+	}
+
 	sc, err := schema.ParseWithNamespace(sch, ns.ID())
 	if err != nil {
 		return fmt.Errorf("error parsing schema: %w", err)
@@ -205,8 +387,28 @@ func (engine *Engine) alterSchema(ctx context.Context, ns *Namespace, sch string
 }
 
 func (engine *Engine) alterSchemaWithParsed(ctx context.Context, sc *schema.ParsedSchema) error {
+	engine.commitMutex.Lock()
+	defer engine.commitMutex.Unlock()
+
+	// Predicates whose schema is not changing are skipped, altering the schema of a
+	// predicate fails while there are pending transactions that wrote to it.
+	preds := make([]*pb.SchemaUpdate, 0, len(sc.Preds))
 	for _, pred := range sc.Preds {
 		worker.InitTablet(pred.Predicate)
+		if current, ok := schema.State().Get(ctx, pred.Predicate); ok && proto.Equal(&current, pred) {
+			continue
+		}
+		preds = append(preds, pred)
+	}
+	types := make([]*pb.TypeUpdate, 0, len(sc.Types))
+	for _, typ := range sc.Types {
+		if current, ok := schema.State().GetType(typ.TypeName); ok && proto.Equal(&current, typ) {
+			continue
+		}
+		types = append(types, typ)
+	}
+	if len(preds) == 0 && len(types) == 0 {
+		return nil
 	}
 
 	startTs, err := engine.z.nextTs()
@@ -217,12 +419,15 @@ func (engine *Engine) alterSchemaWithParsed(ctx context.Context, sc *schema.Pars
 	p := &pb.Proposal{Mutations: &pb.Mutations{
 		GroupId: 1,
 		StartTs: startTs,
-		Schema:  sc.Preds,
-		Types:   sc.Types,
+		Schema:  preds,
+		Types:   types,
 	}}
 	if err := worker.ApplyMutations(ctx, p); err != nil {
 		return fmt.Errorf("error applying mutation: %w", err)
 	}
+
+	// indexes are rebuilt at startTs, move the read timestamp so that they are visible
+	engine.o.commit(startTs, nil)
 	return nil
 }
 
@@ -238,103 +443,95 @@ func (engine *Engine) queryWithLock(ctx context.Context, ns *Namespace, q string
 		return nil, ErrClosedEngine
 	}
 
-	ctx = x.AttachNamespace(ctx, ns.ID())
-	return (&edgraph.Server{}).QueryNoAuth(ctx, &api.Request{
-		ReadOnly: true,
-		Query:    q,
-		StartTs:  engine.z.readTs(),
-	})
+	txn := ns.newReadOnlyTxnWithLock()
+	defer txn.release()
+	return txn.queryWithLock(ctx, q)
 }
 
-func (engine *Engine) mutate(ctx context.Context, ns *Namespace, ms []*api.Mutation) (map[string]uint64, error) {
+func (engine *Engine) mutate(ctx context.Context, ns *Namespace, ms []*api.Mutation) (*MutationResult, error) {
 	if len(ms) == 0 {
-		return nil, nil
+		return &MutationResult{}, nil
 	}
 
-	engine.mutex.Lock()
-	defer engine.mutex.Unlock()
-	dms := make([]*dql.Mutation, 0, len(ms))
-	for _, mu := range ms {
-		dm, err := edgraph.ParseMutationObject(mu, false)
-		if err != nil {
-			return nil, fmt.Errorf("error parsing mutation: %w", err)
-		}
-		dms = append(dms, dm)
-	}
-	newUids, err := query.ExtractBlankUIDs(ctx, dms)
+	start := time.Now()
+	dms, err := parseMutations(ms)
 	if err != nil {
 		return nil, err
 	}
-	if len(newUids) > 0 {
-		num := &pb.Num{Val: uint64(len(newUids)), Type: pb.Num_UID}
-		res, err := engine.z.nextUIDs(num)
-		if err != nil {
-			return nil, err
-		}
+	parsing := time.Since(start)
 
-		curId := res.StartId
-		for k := range newUids {
-			x.AssertTruef(curId != 0 && curId <= res.EndId, "not enough uids generated")
-			newUids[k] = curId
-			curId++
-		}
-	}
-
-	return engine.mutateWithDqlMutation(ctx, ns, dms, newUids)
-}
-
-func (engine *Engine) mutateWithDqlMutation(ctx context.Context, ns *Namespace, dms []*dql.Mutation,
-	newUids map[string]uint64) (map[string]uint64, error) {
-	edges, err := query.ToDirectedEdges(dms, newUids)
-	if err != nil {
-		return nil, fmt.Errorf("error converting to directed edges: %w", err)
-	}
-	ctx = x.AttachNamespace(ctx, ns.ID())
-
-	if !engine.isOpen.Load() {
-		return nil, ErrClosedEngine
-	}
+	engine.mutex.RLock()
+	defer engine.mutex.RUnlock()
 
-	startTs, err := engine.z.nextTs()
+	txn, err := ns.newTxnWithLock()
 	if err != nil {
 		return nil, err
 	}
-	commitTs, err := engine.z.nextTs()
+	newUids, err := txn.mutateParsedWithLock(ctx, dms)
 	if err != nil {
+		return nil, errors.Join(err, txn.discardWithLock(ctx))
+	}
+	if err := txn.commitWithLock(ctx); err != nil {
 		return nil, err
 	}
 
-	m := &pb.Mutations{
-		GroupId: 1,
-		StartTs: startTs,
-		Edges:   edges,
-	}
+	total := time.Since(start)
+	return &MutationResult{
+		Uids:     newUids,
+		StartTs:  txn.startTs,
+		CommitTs: txn.commitTs,
+		Latency:  Latency{Parsing: parsing, Processing: total - parsing, Total: total},
+	}, nil
+}
 
-	m.Edges, err = query.ExpandEdges(ctx, m)
-	if err != nil {
-		return nil, fmt.Errorf("error expanding edges: %w", err)
-	}
+func (engine *Engine) upsert(ctx context.Context, ns *Namespace, q string,
+	ms []*api.Mutation) (*api.Response, *MutationResult, error) {
 
-	for _, edge := range m.Edges {
-		worker.InitTablet(edge.Attr)
-	}
+	engine.mutex.RLock()
+	defer engine.mutex.RUnlock()
 
-	p := &pb.Proposal{Mutations: m, StartTs: startTs}
-	if err := worker.ApplyMutations(ctx, p); err != nil {
-		return nil, err
+	start := time.Now()
+	txn, err := ns.newTxnWithLock()
+	if err != nil {
+		return nil, nil, err
 	}
+	resp, newUids, err := txn.upsertWithLock(ctx, q, ms)
+	if err != nil {
+		return nil, nil, errors.Join(err, txn.discardWithLock(ctx))
+	}
+	if err := txn.commitWithLock(ctx); err != nil {
+		return nil, nil, err
+	}
+
+	// the latency of the query covers the whole upsert but the commit, only the
+	// encoding of the query result is left out of the latency of the mutations
+	lat := latencyFromProto(resp.GetLatency())
+	total := time.Since(start)
+	return resp, &MutationResult{
+		Uids:     newUids,
+		StartTs:  txn.startTs,
+		CommitTs: txn.commitTs,
+		Latency: Latency{
+			Parsing:    lat.Parsing,
+			Processing: total - lat.Parsing - lat.Encoding,
+			Total:      total,
+		},
+	}, nil
+}
 
-	return newUids, worker.ApplyCommited(ctx, &pb.OracleDelta{
-		Txns: []*pb.TxnStatus{{StartTs: startTs, CommitTs: commitTs}},
-	})
+func (engine *Engine) Load(ctx context.Context, schemaPath, dataPath string,
+	opts ...LoadOptions) (*LoadSummary, error) {
+	return engine.db0.Load(ctx, schemaPath, dataPath, opts...)
 }
 
-func (engine *Engine) Load(ctx context.Context, schemaPath, dataPath string) error {
-	return engine.db0.Load(ctx, schemaPath, dataPath)
+func (engine *Engine) LoadData(inCtx context.Context, dataDir string,
+	opts ...LoadOptions) (*LoadSummary, error) {
+	return engine.db0.LoadData(inCtx, dataDir, opts...)
 }
 
-func (engine *Engine) LoadData(inCtx context.Context, dataDir string) error {
-	return engine.db0.LoadData(inCtx, dataDir)
+func (engine *Engine) BulkLoad(ctx context.Context, schemaPath, dataPath string,
+	opts ...LoadOptions) (*LoadSummary, error) {
+	return engine.db0.BulkLoad(ctx, schemaPath, dataPath, opts...)
 }
 
 // Close closes the modusDB instance.
@@ -376,5 +573,6 @@ func (ns *Engine) reset() error {
 	}
 
 	ns.z = z
+	ns.o = newOracle(z.readTs(), worker.State.Pstore.SetDiscardTs)
 	return nil
 }
@@ -0,0 +1,264 @@
+/*
+ * SPDX-FileCopyrightText: © Hypermode Inc. <hello@hypermode.com>
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package modusdb
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+
+	"github.com/dgraph-io/badger/v4"
+	bpb "github.com/dgraph-io/badger/v4/pb"
+	"github.com/dgraph-io/ristretto/v2/z"
+	"github.com/hypermodeinc/dgraph/v24/posting"
+	"github.com/hypermodeinc/dgraph/v24/protos/pb"
+	"github.com/hypermodeinc/dgraph/v24/worker"
+	"github.com/hypermodeinc/dgraph/v24/x"
+	"google.golang.org/protobuf/proto"
+)
+
+// ExportFormat is the format of the files written by Namespace.Export,
+// all of them can be loaded back with Namespace.Load.
+type ExportFormat string
+
+const (
+	ExportRDF      ExportFormat = "rdf"
+	ExportRDFGzip  ExportFormat = "rdf.gz"
+	ExportJSON     ExportFormat = "json"
+	ExportJSONGzip ExportFormat = "json.gz"
+
+	exportFileName = "export"
+)
+
+// ExportedFiles has the paths of the files written by Namespace.Export.
+type ExportedFiles struct {
+	SchemaFile string
+	DataFile   string
+	ReadTs     uint64
+}
+
+func (f ExportFormat) dataFormat() string {
+	switch f {
+	case ExportRDF, ExportRDFGzip:
+		return "rdf"
+	case ExportJSON, ExportJSONGzip:
+		return "json"
+	default:
+		return ""
+	}
+}
+
+func (f ExportFormat) gzip() bool {
+	return f == ExportRDFGzip || f == ExportJSONGzip
+}
+
+// Export writes the schema and a consistent snapshot of the data of the namespace
+// into dir, creating it if needed. The files can be loaded into any namespace,
+// of this or another modusDB instance, using Namespace.Load. The UIDs are not
+// preserved, they are treated as blank nodes when loaded.
+func (ns *Namespace) Export(ctx context.Context, dir string, format ExportFormat) (*ExportedFiles, error) {
+	return ns.engine.export(ctx, ns, dir, format)
+}
+
+func (engine *Engine) export(ctx context.Context, ns *Namespace, dir string,
+	format ExportFormat) (*ExportedFiles, error) {
+
+	engine.mutex.RLock()
+	defer engine.mutex.RUnlock()
+
+	if !engine.isOpen.Load() {
+		return nil, ErrClosedEngine
+	}
+	if !engine.z.namespaceExists(ns.ID()) {
+		return nil, ErrNonExistentDB
+	}
+	if format.dataFormat() == "" {
+		return nil, fmt.Errorf("invalid export format [%v]", format)
+	}
+	if err := os.MkdirAll(dir, 0700); err != nil {
+		return nil, fmt.Errorf("error creating export directory: %w", err)
+	}
+
+	readTs := engine.o.pin()
+	defer engine.o.unpin(readTs)
+
+	ext := ""
+	if format.gzip() {
+		ext = ".gz"
+	}
+	files := &ExportedFiles{
+		SchemaFile: filepath.Join(dir, exportFileName+".schema"+ext),
+		DataFile:   filepath.Join(dir, exportFileName+"."+format.dataFormat()+ext),
+		ReadTs:     readTs,
+	}
+
+	if err := writeExportFile(files.SchemaFile, format.gzip(), func(w io.Writer) error {
+		return exportSchema(w, ns.ID(), readTs)
+	}); err != nil {
+		return nil, fmt.Errorf("error exporting schema: %w", err)
+	}
+	if err := writeExportFile(files.DataFile, format.gzip(), func(w io.Writer) error {
+		return exportData(ctx, w, ns.ID(), readTs, format.dataFormat())
+	}); err != nil {
+		return nil, fmt.Errorf("error exporting data: %w", err)
+	}
+	return files, nil
+}
+
+func writeExportFile(path string, compress bool, write func(w io.Writer) error) error {
+	fd, err := os.Create(path)
+	if err != nil {
+		return err
+	}
+	defer fd.Close()
+
+	bw := bufio.NewWriterSize(fd, 1<<20)
+	var w io.Writer = bw
+	var gw *gzip.Writer
+	if compress {
+		gw = gzip.NewWriter(bw)
+		w = gw
+	}
+
+	if err := write(w); err != nil {
+		return err
+	}
+	if gw != nil {
+		if err := gw.Close(); err != nil {
+			return err
+		}
+	}
+	if err := bw.Flush(); err != nil {
+		return err
+	}
+	return fd.Sync()
+}
+
+// exportSchema writes the predicates and types of the namespace, except the reserved
+// ones, which are created along with every namespace.
+func exportSchema(w io.Writer, nsID, readTs uint64) error {
+	txn := worker.State.Pstore.NewTransactionAt(readTs, false)
+	defer txn.Discard()
+
+	for _, prefix := range []byte{x.ByteSchema, x.ByteType} {
+		iopts := badger.DefaultIteratorOptions
+		iopts.Prefix = append([]byte{prefix}, x.NamespaceToBytes(nsID)...)
+		if err := func() error {
+			itr := txn.NewIterator(iopts)
+			defer itr.Close()
+
+			for itr.Rewind(); itr.Valid(); itr.Next() {
+				item := itr.Item()
+				if item.IsDeletedOrExpired() {
+					continue
+				}
+				pk, err := x.Parse(item.Key())
+				if err != nil {
+					return fmt.Errorf("error parsing key: %w", err)
+				}
+				val, err := item.ValueCopy(nil)
+				if err != nil {
+					return fmt.Errorf("error reading value: %w", err)
+				}
+
+				var kv *bpb.KV
+				switch attr := x.ParseAttr(pk.Attr); prefix {
+				case x.ByteSchema:
+					if x.IsReservedPredicate(attr) {
+						continue
+					}
+					kv, err = worker.SchemaExportKv(pk.Attr, val, true)
+				default:
+					if x.IsReservedType(attr) {
+						continue
+					}
+					kv, err = worker.TypeExportKv(pk.Attr, val)
+				}
+				if err != nil {
+					return fmt.Errorf("error exporting [%v]: %w", x.ParseAttr(pk.Attr), err)
+				}
+				if _, err := w.Write(kv.Value); err != nil {
+					return err
+				}
+			}
+			return nil
+		}(); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+func exportData(ctx context.Context, w io.Writer, nsID, readTs uint64, format string) error {
+	in := &pb.ExportRequest{ReadTs: readTs, Namespace: nsID, Format: format}
+
+	stream := worker.State.Pstore.NewStreamAt(readTs)
+	stream.LogPrefix = "modusDB.Export"
+	stream.Prefix = append([]byte{x.DefaultPrefix}, x.NamespaceToBytes(nsID)...)
+	stream.ChooseKey = func(item *badger.Item) bool {
+		if item.IsDeletedOrExpired() || isZeroStateKey(item.Key()) {
+			return false
+		}
+		pk, err := x.Parse(item.Key())
+		if err != nil {
+			return false
+		}
+		// parts of a multi-part list are read from the main key
+		return pk.IsData() && !pk.HasStartUid
+	}
+	stream.KeyToList = func(key []byte, itr *badger.Iterator) (*bpb.KVList, error) {
+		pk, err := x.Parse(key)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing key: %w", err)
+		}
+		pl, err := posting.ReadPostingList(key, itr)
+		if err != nil {
+			return nil, fmt.Errorf("error reading posting list: %w", err)
+		}
+		return worker.ToExportKvList(pk, pl, in)
+	}
+
+	pre, sep, post := "", "", ""
+	if format == "json" {
+		pre, sep, post = "[\n", ",\n", "\n]\n"
+	}
+
+	hasDataBefore := false
+	stream.Send = func(buf *z.Buffer) error {
+		kv := &bpb.KV{}
+		return buf.SliceIterate(func(s []byte) error {
+			kv.Reset()
+			if err := proto.Unmarshal(s, kv); err != nil {
+				return err
+			}
+			// only data is written, the GraphQL schema is not supported by modusDB
+			if kv.Version != 1 || len(kv.Value) == 0 {
+				return nil
+			}
+			if hasDataBefore {
+				if _, err := io.WriteString(w, sep); err != nil {
+					return err
+				}
+			}
+			hasDataBefore = true
+			_, err := w.Write(kv.Value)
+			return err
+		})
+	}
+
+	if _, err := io.WriteString(w, pre); err != nil {
+		return err
+	}
+	if err := stream.Orchestrate(ctx); err != nil {
+		return err
+	}
+	_, err := io.WriteString(w, post)
+	return err
+}
@@ -6,11 +6,13 @@
 package modusdb
 
 import (
+	"compress/gzip"
 	"context"
 	"fmt"
 	"io"
 	"log"
 	"os"
+	"strings"
 	"sync"
 	"time"
 
@@ -23,57 +25,234 @@ import (
 )
 
 const (
-	maxRoutines       = 4
-	batchSize         = 1000
-	numBatchesInBuf   = 100
-	progressFrequency = 5 * time.Second
+	defaultConcurrency      = 4
+	defaultBatchSize        = 1000
+	defaultProgressInterval = 5 * time.Second
 )
 
 type liveLoader struct {
-	n *Namespace
+	n          *Namespace
+	opts       LoadOptions
+	checkpoint *loadCheckpoint
 
+	// the UIDs of the blank nodes, guarded by mutex along with the sending of batches
 	blankNodes map[string]string
-	mutex      sync.RWMutex
+	mutex      sync.Mutex
 }
 
-func (n *Namespace) Load(ctx context.Context, schemaPath, dataPath string) error {
-	schemaData, err := os.ReadFile(schemaPath)
+// loadBatch is a batch of N-Quads committed in one transaction.
+type loadBatch struct {
+	mu *api.Mutation
+	// the UIDs leased for the blank nodes first seen in the batch, persisted before
+	// it is committed when the load is checkpointed
+	uids map[string]uint64
+	// the file is loaded up to offset once the batch is committed, set on the
+	// last batch of every chunk
+	file   string
+	offset int64
+}
+
+// LoadErrorPolicy decides what happens when a data file cannot be loaded.
+type LoadErrorPolicy int
+
+const (
+	// LoadErrorFail stops the load at the first file that fails.
+	LoadErrorFail LoadErrorPolicy = iota
+	// LoadErrorSkip skips the files that fail and reports them in LoadSummary.
+	// The N-Quads of a skipped file read before the error may have been loaded.
+	LoadErrorSkip
+)
+
+// LoadOptions configures Namespace.Load and Namespace.LoadData.
+type LoadOptions struct {
+	// Concurrency is the number of files processed in parallel, defaults to 4.
+	Concurrency int
+	// BatchSize is the number of N-Quads committed in each transaction, defaults to 1000.
+	BatchSize int
+	// Progress is called every ProgressInterval, which defaults to 5 seconds.
+	// The progress is logged when it is nil.
+	Progress         func(LoadProgress)
+	ProgressInterval time.Duration
+	// OnFileError is applied to the errors reading or parsing a data file.
+	// Errors applying the mutations always stop the load.
+	OnFileError LoadErrorPolicy
+	// Checkpoint makes the load resumable. The UIDs assigned to the blank nodes and
+	// the progress in every file are persisted in the namespace under this name, so
+	// running the same load again with the same Checkpoint continues where the previous
+	// run stopped, reusing the same UIDs. Files loaded completely are skipped.
+	// JSON files cannot be checkpointed, as the chunker gives their objects without a
+	// uid random blank node names, and the load fails if any is found.
+	// See Namespace.DeleteLoadCheckpoint.
+	Checkpoint string
+
+	// CSV maps the names of the CSV files, without the .csv or .csv.gz extension,
+	// to the mapping of their columns. Every CSV file loaded must have a mapping.
+	CSV map[string]CSVMapping
+}
+
+// LoadProgress is passed to LoadOptions.Progress while data is being loaded.
+type LoadProgress struct {
+	Elapsed time.Duration
+	// NQuads is the number of N-Quads loaded so far.
+	NQuads int
+	// Rate is the number of N-Quads loaded per second since the last progress.
+	Rate float64
+}
+
+// LoadSummary is returned by Namespace.Load and Namespace.LoadData once all the files are processed.
+type LoadSummary struct {
+	Elapsed time.Duration
+	Files   int
+	NQuads  int
+	// Rate is the average number of N-Quads loaded per second.
+	Rate float64
+	// SkippedFiles has the errors of the files skipped with LoadErrorSkip.
+	SkippedFiles map[string]error
+}
+
+func (o *LoadOptions) withDefaults() LoadOptions {
+	opts := *o
+	if opts.Concurrency <= 0 {
+		opts.Concurrency = defaultConcurrency
+	}
+	if opts.BatchSize <= 0 {
+		opts.BatchSize = defaultBatchSize
+	}
+	if opts.ProgressInterval <= 0 {
+		opts.ProgressInterval = defaultProgressInterval
+	}
+	if opts.Progress == nil {
+		opts.Progress = func(p LoadProgress) {
+			elapsed := p.Elapsed.Round(time.Second)
+			log.Printf("Elapsed: %v, N-Quads: %d, N-Quads/s: %5.0f", x.FixedDuration(elapsed), p.NQuads, p.Rate)
+		}
+	}
+	return opts
+}
+
+func (n *Namespace) Load(ctx context.Context, schemaPath, dataPath string,
+	opts ...LoadOptions) (*LoadSummary, error) {
+
+	schemaData, err := readSchemaFile(schemaPath)
 	if err != nil {
-		return fmt.Errorf("error reading schema file [%v]: %w", schemaPath, err)
+		return nil, fmt.Errorf("error reading schema file [%v]: %w", schemaPath, err)
 	}
 	if err := n.AlterSchema(ctx, string(schemaData)); err != nil {
-		return fmt.Errorf("error altering schema: %w", err)
+		return nil, fmt.Errorf("error altering schema: %w", err)
+	}
+
+	summary, err := n.LoadData(ctx, dataPath, opts...)
+	if err != nil {
+		return nil, fmt.Errorf("error loading data: %w", err)
+	}
+	return summary, nil
+}
+
+// readSchemaFile reads the schema file, decompressing it if it is gzipped.
+func readSchemaFile(schemaPath string) ([]byte, error) {
+	fd, err := os.Open(schemaPath)
+	if err != nil {
+		return nil, err
+	}
+	defer fd.Close()
+
+	var r io.Reader = fd
+	if strings.HasSuffix(schemaPath, ".gz") {
+		gr, err := gzip.NewReader(fd)
+		if err != nil {
+			return nil, err
+		}
+		defer gr.Close()
+		r = gr
 	}
+	return io.ReadAll(r)
+}
 
-	if err := n.LoadData(ctx, dataPath); err != nil {
-		return fmt.Errorf("error loading data: %w", err)
+// LoadData loads the RDF, JSON and CSV files found in dataDir, which can also be
+// a single file. CSV files are loaded according to their mapping in LoadOptions.
+func (n *Namespace) LoadData(inCtx context.Context, dataDir string, opts ...LoadOptions) (*LoadSummary, error) {
+	ll, err := newLiveLoader(n, opts)
+	if err != nil {
+		return nil, err
 	}
-	return nil
+	return ll.run(inCtx, dataDir, func(ctx context.Context, mu *api.Mutation) error {
+		uids, err := n.Mutate(ctx, []*api.Mutation{mu})
+		if err != nil {
+			return fmt.Errorf("error applying mutations: %w", err)
+		}
+		x.AssertTruef(len(uids) == 0, "no UIDs should be returned for live loader")
+		return nil
+	})
 }
 
-// TODO: Add support for CSV file
-func (n *Namespace) LoadData(inCtx context.Context, dataDir string) error {
+func newLiveLoader(n *Namespace, opts []LoadOptions) (*liveLoader, error) {
+	if len(opts) > 1 {
+		return nil, fmt.Errorf("only one load options is allowed")
+	}
+	ll := &liveLoader{n: n, blankNodes: make(map[string]string)}
+	if len(opts) == 1 {
+		ll.opts = opts[0].withDefaults()
+	} else {
+		ll.opts = (&LoadOptions{}).withDefaults()
+	}
+	if ll.opts.Checkpoint != "" {
+		ll.checkpoint = &loadCheckpoint{ns: n.ID(), name: ll.opts.Checkpoint}
+		blankNodes, err := ll.checkpoint.blankNodes()
+		if err != nil {
+			return nil, fmt.Errorf("error reading UIDs from checkpoint: %w", err)
+		}
+		ll.blankNodes = blankNodes
+	}
+	return ll, nil
+}
+
+// run reads the data files and passes the N-Quads, with their UIDs assigned, to apply
+// in batches. apply is called from a single goroutine.
+func (l *liveLoader) run(inCtx context.Context, dataDir string,
+	apply func(ctx context.Context, mu *api.Mutation) error) (*LoadSummary, error) {
+
 	fs := filestore.NewFileStore(dataDir)
-	files := fs.FindDataFiles(dataDir, []string{".rdf", ".rdf.gz", ".json", ".json.gz"})
+	files := fs.FindDataFiles(dataDir, []string{".rdf", ".rdf.gz", ".json", ".json.gz", ".csv", ".csv.gz"})
 	if len(files) == 0 {
-		return errors.Errorf("no data files found in [%v]", dataDir)
+		return nil, errors.Errorf("no data files found in [%v]", dataDir)
 	}
 	log.Printf("found %d data file(s) to process", len(files))
+	if l.checkpoint != nil {
+		for _, f := range files {
+			if strings.HasSuffix(f, ".json") || strings.HasSuffix(f, ".json.gz") {
+				return nil, errors.Errorf("JSON data file [%v] cannot be loaded with a checkpoint", f)
+			}
+		}
+	}
 
 	// Here, we build a context tree so that we can wait for the goroutines towards the
 	// end. This also ensures that we can cancel the context tree if there is an error.
 	rootG, rootCtx := errgroup.WithContext(inCtx)
 	procG, procCtx := errgroup.WithContext(rootCtx)
-	procG.SetLimit(maxRoutines)
+	procG.SetLimit(l.opts.Concurrency)
 
 	// start a goroutine to do the mutations
 	start := time.Now()
 	nqudsProcessed := 0
-	nqch := make(chan *api.Mutation, 10000)
+	nqch := make(chan *loadBatch, 10000)
 	rootG.Go(func() error {
-		ticker := time.NewTicker(progressFrequency)
+		ticker := time.NewTicker(l.opts.ProgressInterval)
 		defer ticker.Stop()
 
+		// the offsets of the chunks committed, persisted along with the UIDs of the
+		// next batch, or once all the batches are committed
+		offsets := make(map[string]int64)
+		writeCheckpoint := func(uids map[string]uint64) error {
+			if l.checkpoint == nil || (len(uids) == 0 && len(offsets) == 0) {
+				return nil
+			}
+			if err := l.checkpoint.write(uids, offsets); err != nil {
+				return fmt.Errorf("error writing checkpoint: %w", err)
+			}
+			clear(offsets)
+			return nil
+		}
+
 		last := nqudsProcessed
 		for {
 			select {
@@ -81,29 +260,48 @@ func (n *Namespace) LoadData(inCtx context.Context, dataDir string) error {
 				return rootCtx.Err()
 
 			case <-ticker.C:
-				elapsed := time.Since(start).Round(time.Second)
-				rate := float64(nqudsProcessed-last) / progressFrequency.Seconds()
-				log.Printf("Elapsed: %v, N-Quads: %d, N-Quads/s: %5.0f", x.FixedDuration(elapsed), nqudsProcessed, rate)
+				l.opts.Progress(LoadProgress{
+					Elapsed: time.Since(start),
+					NQuads:  nqudsProcessed,
+					Rate:    float64(nqudsProcessed-last) / l.opts.ProgressInterval.Seconds(),
+				})
 				last = nqudsProcessed
 
-			case nqs, ok := <-nqch:
+			case batch, ok := <-nqch:
 				if !ok {
-					return nil
+					return writeCheckpoint(nil)
+				}
+				if len(batch.uids) > 0 {
+					if err := writeCheckpoint(batch.uids); err != nil {
+						return err
+					}
+				}
+				if len(batch.mu.Set) > 0 {
+					if err := apply(rootCtx, batch.mu); err != nil {
+						return err
+					}
+					nqudsProcessed += len(batch.mu.Set)
 				}
-				uids, err := n.Mutate(rootCtx, []*api.Mutation{nqs})
-				if err != nil {
-					return fmt.Errorf("error applying mutations: %w", err)
+				if batch.offset != 0 {
+					offsets[batch.file] = batch.offset
 				}
-				x.AssertTruef(len(uids) == 0, "no UIDs should be returned for live loader")
-				nqudsProcessed += len(nqs.Set)
 			}
 		}
 	})
 
-	ll := &liveLoader{n: n, blankNodes: make(map[string]string)}
+	var skippedMutex sync.Mutex
+	skipped := make(map[string]error)
 	for _, datafile := range files {
 		procG.Go(func() error {
-			return ll.processFile(procCtx, fs, datafile, nqch)
+			err := l.processFile(procCtx, fs, datafile, nqch)
+			if err == nil || l.opts.OnFileError != LoadErrorSkip || procCtx.Err() != nil {
+				return err
+			}
+			log.Printf("skipping data file [%v]: %v", datafile, err)
+			skippedMutex.Lock()
+			skipped[datafile] = err
+			skippedMutex.Unlock()
+			return nil
 		})
 	}
 
@@ -116,14 +314,37 @@ func (n *Namespace) LoadData(inCtx context.Context, dataDir string) error {
 
 	// close the channel and wait for the mutations to finish
 	close(nqch)
-	return rootG.Wait()
+	if err := rootG.Wait(); err != nil {
+		return nil, err
+	}
+
+	elapsed := time.Since(start)
+	return &LoadSummary{
+		Elapsed:      elapsed,
+		Files:        len(files) - len(skipped),
+		NQuads:       nqudsProcessed,
+		Rate:         float64(nqudsProcessed) / elapsed.Seconds(),
+		SkippedFiles: skipped,
+	}, nil
 }
 
-func (l *liveLoader) processFile(inCtx context.Context, fs filestore.FileStore,
-	filename string, nqch chan *api.Mutation) error {
+func (l *liveLoader) processFile(ctx context.Context, fs filestore.FileStore,
+	filename string, nqch chan *loadBatch) error {
 
+	offset, err := l.fileOffset(filename)
+	if err != nil {
+		return err
+	}
+	if offset == fileLoaded {
+		log.Printf("skipping data file [%v], already loaded", filename)
+		return nil
+	}
 	log.Printf("processing data file [%v]", filename)
 
+	if isCSVFile(filename) {
+		return l.processCSVFile(ctx, fs, filename, offset, nqch)
+	}
+
 	rd, cleanup := fs.ChunkReader(filename, nil)
 	defer cleanup()
 
@@ -138,116 +359,131 @@ func (l *liveLoader) processFile(inCtx context.Context, fs filestore.FileStore,
 		}
 	}
 
-	g, ctx := errgroup.WithContext(inCtx)
-	ck := chunker.NewChunker(loadType, batchSize)
-	nqbuf := ck.NQuads()
-
-	g.Go(func() error {
-		buffer := make([]*api.NQuad, 0, numBatchesInBuf*batchSize)
-
-		drain := func() {
-			for len(buffer) > 0 {
-				sz := batchSize
-				if len(buffer) < batchSize {
-					sz = len(buffer)
-				}
-				nqch <- &api.Mutation{Set: buffer[:sz]}
-				buffer = buffer[sz:]
-			}
+	if offset > 0 {
+		if _, err := io.CopyN(io.Discard, rd, offset); err != nil {
+			return fmt.Errorf("error resuming [%v] at offset %d: %w", filename, offset, err)
 		}
+	}
 
-		loop := true
-		for loop {
-			select {
-			case <-ctx.Done():
-				return ctx.Err()
+	ck := chunker.NewChunker(loadType, 0)
+	for {
+		if err := ctx.Err(); err != nil {
+			return err
+		}
 
-			case nqs, ok := <-nqbuf.Ch():
-				if !ok {
-					loop = false
-					break
-				}
-				if len(nqs) == 0 {
-					continue
-				}
+		chunkBuf, errChunk := ck.Chunk(rd)
+		if errChunk != nil && errChunk != io.EOF {
+			return fmt.Errorf("error chunking data: %w", errChunk)
+		}
+		if chunkBuf != nil {
+			offset += int64(chunkBuf.Len())
+		}
 
-				var err error
-				for _, nq := range nqs {
-					nq.Subject, err = l.uid(nq.Namespace, nq.Subject)
-					if err != nil {
-						return fmt.Errorf("error getting UID for subject: %w", err)
-					}
-					if len(nq.ObjectId) > 0 {
-						nq.ObjectId, err = l.uid(nq.Namespace, nq.ObjectId)
-						if err != nil {
-							return fmt.Errorf("error getting UID for object: %w", err)
-						}
-					}
-				}
+		// a new chunker is used for every chunk, so that its N-Quads are sent together
+		// with the offset the file is loaded up to once they are committed
+		pk := chunker.NewChunker(loadType, 0)
+		if err := pk.Parse(chunkBuf); err != nil {
+			return fmt.Errorf("error parsing chunk: %w", err)
+		}
+		pk.NQuads().Flush()
+		nqs := <-pk.NQuads().Ch()
 
-				buffer = append(buffer, nqs...)
-				if len(buffer) < numBatchesInBuf*batchSize {
-					continue
-				}
-				drain()
-			}
+		checkpoint := offset
+		if errChunk == io.EOF {
+			checkpoint = fileLoaded
 		}
-		drain()
-		return nil
-	})
+		if err := l.send(ctx, nqch, nqs, filename, checkpoint); err != nil {
+			return err
+		}
+		if errChunk == io.EOF {
+			return nil
+		}
+	}
+}
 
-	g.Go(func() error {
-		for {
-			select {
-			case <-ctx.Done():
-				return ctx.Err()
-			default:
-			}
+// send sends the N-Quads to be committed in batches, the last one carrying the offset
+// the file is loaded up to, if not zero. The UIDs are assigned and the batches sent under
+// the mutex, so that no batch using the UID of a blank node is committed before the batch
+// persisting it.
+func (l *liveLoader) send(ctx context.Context, nqch chan *loadBatch, nqs []*api.NQuad,
+	filename string, offset int64) error {
 
-			chunkBuf, errChunk := ck.Chunk(rd)
-			if errChunk != nil && errChunk != io.EOF {
-				return fmt.Errorf("error chunking data: %w", errChunk)
-			}
-			if err := ck.Parse(chunkBuf); err != nil {
-				return fmt.Errorf("error parsing chunk: %w", err)
-			}
-			// We do this here in case of io.EOF, so that we can flush the last batch.
-			if errChunk != nil {
-				break
-			}
+	l.mutex.Lock()
+	defer l.mutex.Unlock()
+
+	for {
+		sz := min(l.opts.BatchSize, len(nqs))
+		batch := &loadBatch{mu: &api.Mutation{Set: nqs[:sz]}}
+		nqs = nqs[sz:]
+		if len(nqs) == 0 {
+			batch.file = filename
+			batch.offset = offset
 		}
 
-		nqbuf.Flush()
-		return nil
-	})
+		var err error
+		batch.uids, err = l.assignUIDs(batch.mu.Set)
+		if err != nil {
+			return err
+		}
 
-	return g.Wait()
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case nqch <- batch:
+		}
+		if len(nqs) == 0 {
+			return nil
+		}
+	}
 }
 
-func (l *liveLoader) uid(ns uint64, val string) (string, error) {
-	key := x.NamespaceAttr(ns, val)
-
-	l.mutex.RLock()
-	uid, ok := l.blankNodes[key]
-	l.mutex.RUnlock()
-	if ok {
-		return uid, nil
+// assignUIDs replaces the subjects and objects of the N-Quads with their UIDs, leasing
+// the UIDs of the blank nodes not seen before at once, and returns them.
+func (l *liveLoader) assignUIDs(nqs []*api.NQuad) (map[string]uint64, error) {
+	uids := make(map[string]uint64)
+	for _, nq := range nqs {
+		for _, val := range []string{nq.Subject, nq.ObjectId} {
+			if len(val) == 0 {
+				continue
+			}
+			key := x.NamespaceAttr(nq.Namespace, val)
+			if _, ok := l.blankNodes[key]; !ok {
+				uids[key] = 0
+			}
+		}
 	}
 
-	l.mutex.Lock()
-	defer l.mutex.Unlock()
+	if len(uids) > 0 {
+		assigned, err := l.n.engine.LeaseUIDs(uint64(len(uids)))
+		if err != nil {
+			return nil, fmt.Errorf("error allocating UIDs: %w", err)
+		}
+		next := assigned.StartId
+		for key := range uids {
+			uids[key] = next
+			l.blankNodes[key] = fmt.Sprintf("%#x", next)
+			next++
+		}
+	}
 
-	uid, ok = l.blankNodes[key]
-	if ok {
-		return uid, nil
+	for _, nq := range nqs {
+		nq.Subject = l.blankNodes[x.NamespaceAttr(nq.Namespace, nq.Subject)]
+		if len(nq.ObjectId) > 0 {
+			nq.ObjectId = l.blankNodes[x.NamespaceAttr(nq.Namespace, nq.ObjectId)]
+		}
 	}
+	return uids, nil
+}
 
-	asUID, err := l.n.engine.LeaseUIDs(1)
+// fileOffset returns the offset the file was loaded up to by a previous run of
+// a checkpointed load, fileLoaded if the whole file was loaded.
+func (l *liveLoader) fileOffset(filename string) (int64, error) {
+	if l.checkpoint == nil {
+		return 0, nil
+	}
+	offset, _, err := l.checkpoint.get(loadOffsetAttr, filename)
 	if err != nil {
-		return "", fmt.Errorf("error allocating UID: %w", err)
+		return 0, fmt.Errorf("error reading offset of [%v] from checkpoint: %w", filename, err)
 	}
-
-	uid = fmt.Sprintf("%#x", asUID.StartId)
-	l.blankNodes[key] = uid
-	return uid, nil
+	return int64(offset), nil
 }
@@ -0,0 +1,134 @@
+/*
+ * SPDX-FileCopyrightText: © Hypermode Inc. <hello@hypermode.com>
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package load_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+
+	"github.com/cavaliergopher/grab/v3"
+	"github.com/dgraph-io/dgo/v240/protos/api"
+	"github.com/hypermodeinc/dgraph/v24/dgraphapi"
+	"github.com/hypermodeinc/dgraph/v24/systest/1million/common"
+	"github.com/stretchr/testify/require"
+
+	"github.com/hypermodeinc/modusdb"
+)
+
+func TestBulkLoaderSmall(t *testing.T) {
+	ctx := context.Background()
+	engine, err := modusdb.NewEngine(modusdb.NewDefaultConfig(t.TempDir()))
+	require.NoError(t, err)
+	defer engine.Close()
+
+	dataFolder := t.TempDir()
+	schemaFile := filepath.Join(dataFolder, "data.schema")
+	dataFile := filepath.Join(dataFolder, "data.rdf")
+	require.NoError(t, os.WriteFile(schemaFile, []byte(DbSchema), 0600))
+	require.NoError(t, os.WriteFile(dataFile, []byte(SmallData), 0600))
+
+	ns, err := engine.CreateNamespace()
+	require.NoError(t, err)
+	summary, err := ns.BulkLoad(ctx, schemaFile, dataFile)
+	require.NoError(t, err)
+	require.Equal(t, 1, summary.Files)
+	require.Equal(t, 11, summary.NQuads)
+
+	// the term and fulltext indexes, reverse edges and counts are built after the load
+	const query = `{
+		caro(func: allofterms(name@en, "Marc Caro")) {
+			name@en
+			director.film(orderasc: name@en) {
+				name@en
+				name@de
+				count(~director.film)
+			}
+		}
+	}`
+	const expected = `{
+		"caro": [
+			{
+				"name@en": "Marc Caro",
+				"director.film": [
+					{"name@en": "Delicatessen", "name@de": "Delicatessen", "count(~director.film)": 2},
+					{
+						"name@en": "The City of Lost Children",
+						"name@de": "Die Stadt der verlorenen Kinder",
+						"count(~director.film)": 2
+					}
+				]
+			}
+		]
+	}`
+	resp, err := ns.Query(ctx, query)
+	require.NoError(t, err)
+	require.JSONEq(t, expected, string(resp.Json))
+
+	// the data written afterwards is indexed and does not reuse the loaded UIDs
+	_, err = ns.Mutate(ctx, []*api.Mutation{{
+		Set: []*api.NQuad{{
+			Subject:     "_:film",
+			Predicate:   "name",
+			ObjectValue: &api.Value{Val: &api.Value_StrVal{StrVal: "Alien Resurrection"}},
+			Lang:        "en",
+		}},
+	}})
+	require.NoError(t, err)
+	resp, err = ns.Query(ctx, `{
+		films(func: has(name), orderasc: name@en) {
+			name@en
+		}
+		alien(func: anyofterms(name@en, "alien")) {
+			count(uid)
+		}
+	}`)
+	require.NoError(t, err)
+	require.JSONEq(t, `{
+		"films": [
+			{"name@en": "Alien Resurrection"},
+			{"name@en": "Delicatessen"},
+			{"name@en": "Marc Caro"},
+			{"name@en": "The City of Lost Children"}
+		],
+		"alien": [{"count": 1}]
+	}`, string(resp.Json))
+
+	_, err = ns.BulkLoad(ctx, schemaFile, dataFile)
+	require.ErrorIs(t, err, modusdb.ErrNamespaceNotEmpty)
+
+	_, err = ns.BulkLoad(ctx, schemaFile, dataFile, modusdb.LoadOptions{Checkpoint: "bulk"})
+	require.Error(t, err)
+}
+
+func TestBulkLoader1Million(t *testing.T) {
+	engine, err := modusdb.NewEngine(modusdb.NewDefaultConfig(t.TempDir()))
+	require.NoError(t, err)
+	defer engine.Close()
+
+	baseDir := t.TempDir()
+	schResp, err := grab.Get(baseDir, oneMillionSchema)
+	require.NoError(t, err)
+	dataResp, err := grab.Get(baseDir, oneMillionRDF)
+	require.NoError(t, err)
+
+	_, err = engine.BulkLoad(context.Background(), schResp.Filename, dataResp.Filename)
+	require.NoError(t, err)
+
+	for _, tt := range common.OneMillionTCs {
+		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
+		resp, err := engine.GetDefaultNamespace().Query(ctx, tt.Query)
+		cancel()
+
+		if ctx.Err() == context.DeadlineExceeded {
+			t.Fatal("aborting test due to query timeout")
+		}
+		require.NoError(t, err)
+		require.NoError(t, dgraphapi.CompareJSON(tt.Resp, string(resp.Json)))
+	}
+}
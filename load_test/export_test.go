@@ -0,0 +1,77 @@
+/*
+ * SPDX-FileCopyrightText: © Hypermode Inc. <hello@hypermode.com>
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package load_test
+
+import (
+	"context"
+	"os"
+	"path/filepath"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/hypermodeinc/modusdb"
+)
+
+func TestExportReimport(t *testing.T) {
+	ctx := context.Background()
+	engine, err := modusdb.NewEngine(modusdb.NewDefaultConfig(t.TempDir()))
+	require.NoError(t, err)
+	defer engine.Close()
+
+	dataFolder := t.TempDir()
+	schemaFile := filepath.Join(dataFolder, "data.schema")
+	dataFile := filepath.Join(dataFolder, "data.rdf")
+	require.NoError(t, os.WriteFile(schemaFile, []byte(DbSchema), 0600))
+	require.NoError(t, os.WriteFile(dataFile, []byte(SmallData), 0600))
+
+	source, err := engine.CreateNamespace()
+	require.NoError(t, err)
+	_, err = source.Load(ctx, schemaFile, dataFile)
+	require.NoError(t, err)
+
+	const query = `{
+		films(func: anyofterms(name@en, "Delicatessen City"), orderasc: name@en) {
+			name@en
+			name@de
+			count(~director.film)
+		}
+	}`
+	const expected = `{
+		"films": [
+			{"name@en": "Delicatessen", "name@de": "Delicatessen", "count(~director.film)": 2},
+			{
+				"name@en": "The City of Lost Children",
+				"name@de": "Die Stadt der verlorenen Kinder",
+				"count(~director.film)": 2
+			}
+		]
+	}`
+
+	formats := []modusdb.ExportFormat{
+		modusdb.ExportRDF, modusdb.ExportRDFGzip, modusdb.ExportJSON, modusdb.ExportJSONGzip,
+	}
+	for _, format := range formats {
+		t.Run(string(format), func(t *testing.T) {
+			files, err := source.Export(ctx, t.TempDir(), format)
+			require.NoError(t, err)
+			require.FileExists(t, files.SchemaFile)
+			require.FileExists(t, files.DataFile)
+
+			target, err := engine.CreateNamespace()
+			require.NoError(t, err)
+			_, err = target.Load(ctx, files.SchemaFile, files.DataFile)
+			require.NoError(t, err)
+
+			resp, err := target.Query(ctx, query)
+			require.NoError(t, err)
+			require.JSONEq(t, expected, string(resp.Json))
+		})
+	}
+
+	_, err = source.Export(ctx, t.TempDir(), "csv")
+	require.Error(t, err)
+}
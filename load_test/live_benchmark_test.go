@@ -7,6 +7,7 @@ package load_test
 
 import (
 	"context"
+	"fmt"
 	"os"
 	"path/filepath"
 	"runtime"
@@ -56,7 +57,8 @@ func BenchmarkDatabaseOperations(b *testing.B) {
 			dataFile := filepath.Join(dataFolder, "data.rdf")
 			require.NoError(b, os.WriteFile(schemaFile, []byte(DbSchema), 0600))
 			require.NoError(b, os.WriteFile(dataFile, []byte(SmallData), 0600))
-			require.NoError(b, engine.Load(context.Background(), schemaFile, dataFile))
+			_, err := engine.Load(context.Background(), schemaFile, dataFile)
+			require.NoError(b, err)
 		}
 		reportMemStats(b, initialAlloc)
 	})
@@ -80,7 +82,8 @@ func BenchmarkDatabaseOperations(b *testing.B) {
 		dataFile := filepath.Join(dataFolder, "data.rdf")
 		require.NoError(b, os.WriteFile(schemaFile, []byte(DbSchema), 0600))
 		require.NoError(b, os.WriteFile(dataFile, []byte(SmallData), 0600))
-		require.NoError(b, engine.Load(context.Background(), schemaFile, dataFile))
+		_, err = engine.Load(context.Background(), schemaFile, dataFile)
+		require.NoError(b, err)
 
 		const query = `{
             caro(func: allofterms(name@en, "Marc Caro")) {
@@ -114,4 +117,63 @@ func BenchmarkDatabaseOperations(b *testing.B) {
 		}
 		reportMemStats(b, initialAlloc)
 	})
+
+	// run with -cpu 1,2,4,8 to see how the reads scale with GOMAXPROCS
+	b.Run("ParallelTypedQuery", func(b *testing.B) {
+		var ms runtime.MemStats
+		runtime.ReadMemStats(&ms)
+		initialAlloc := ms.Alloc
+
+		engine, err := modusdb.NewEngine(modusdb.NewDefaultConfig(b.TempDir()))
+		require.NoError(b, err)
+		defer engine.Close()
+
+		ctx := context.Background()
+		for i := 0; i < 100; i++ {
+			_, _, err := modusdb.Create(ctx, engine, Person{Name: fmt.Sprintf("person-%d", i), Age: i})
+			require.NoError(b, err)
+		}
+
+		// a writer keeps committing in the background, reads must not wait for it
+		writerCtx, cancel := context.WithCancel(ctx)
+		writerDone := make(chan error, 1)
+		go func() {
+			for i := 0; writerCtx.Err() == nil; i++ {
+				if _, _, err := modusdb.Create(ctx, engine, Person{Name: fmt.Sprintf("writer-%d", i)}); err != nil {
+					writerDone <- err
+					return
+				}
+			}
+			writerDone <- nil
+		}()
+
+		queryParams := modusdb.QueryParams{
+			Filter: &modusdb.Filter{
+				Field:  "name",
+				String: modusdb.StringPredicate{Equals: "person-42"},
+			},
+		}
+
+		b.ResetTimer()
+		b.RunParallel(func(pb *testing.PB) {
+			for pb.Next() {
+				_, people, err := modusdb.Query[Person](ctx, engine, queryParams)
+				if err != nil || len(people) != 1 {
+					b.Errorf("unexpected query result: %v, %v", people, err)
+					return
+				}
+			}
+		})
+		b.StopTimer()
+
+		cancel()
+		require.NoError(b, <-writerDone)
+		reportMemStats(b, initialAlloc)
+	})
+}
+
+type Person struct {
+	Gid  uint64 `json:"gid,omitempty"`
+	Name string `json:"name,omitempty" db:"constraint=exact"`
+	Age  int    `json:"age,omitempty"`
 }
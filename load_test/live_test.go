@@ -6,7 +6,10 @@
 package load_test
 
 import (
+	"bytes"
+	"compress/gzip"
 	"context"
+	"fmt"
 	"os"
 	"path/filepath"
 	"testing"
@@ -54,7 +57,10 @@ func TestLiveLoaderSmall(t *testing.T) {
 	dataFile := filepath.Join(dataFolder, "data.rdf")
 	require.NoError(t, os.WriteFile(schemaFile, []byte(DbSchema), 0600))
 	require.NoError(t, os.WriteFile(dataFile, []byte(SmallData), 0600))
-	require.NoError(t, engine.Load(context.Background(), schemaFile, dataFile))
+	summary, err := engine.Load(context.Background(), schemaFile, dataFile)
+	require.NoError(t, err)
+	require.Equal(t, 1, summary.Files)
+	require.Equal(t, 11, summary.NQuads)
 
 	const query = `{
 		caro(func: allofterms(name@en, "Marc Caro")) {
@@ -97,7 +103,8 @@ func TestLiveLoader1Million(t *testing.T) {
 	require.NoError(t, err)
 
 	require.NoError(t, engine.DropAll(context.Background()))
-	require.NoError(t, engine.Load(context.Background(), schResp.Filename, dataResp.Filename))
+	_, err = engine.Load(context.Background(), schResp.Filename, dataResp.Filename)
+	require.NoError(t, err)
 
 	for _, tt := range common.OneMillionTCs {
 		ctx, cancel := context.WithTimeout(context.Background(), 10*time.Minute)
@@ -111,3 +118,199 @@ func TestLiveLoader1Million(t *testing.T) {
 		require.NoError(t, dgraphapi.CompareJSON(tt.Resp, string(resp.Json)))
 	}
 }
+
+func TestLiveLoaderCSV(t *testing.T) {
+	ctx := context.Background()
+	engine, err := modusdb.NewEngine(modusdb.NewDefaultConfig(t.TempDir()))
+	require.NoError(t, err)
+	defer engine.Close()
+
+	dataFolder := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dataFolder, "people.csv"), []byte(
+		"id,name,age,employer,ignored\n"+
+			"1,Alice,34,10,x\n"+
+			"2,\"Bob, Jr.\",27,10,y\n"+
+			"3,Carol,,11,z\n"), 0600))
+
+	var companies bytes.Buffer
+	gw := gzip.NewWriter(&companies)
+	_, err = gw.Write([]byte("key,name\n10,Acme\n11,Globex\n"))
+	require.NoError(t, err)
+	require.NoError(t, gw.Close())
+	require.NoError(t, os.WriteFile(filepath.Join(dataFolder, "companies.csv.gz"), companies.Bytes(), 0600))
+
+	ns := engine.GetDefaultNamespace()
+	require.NoError(t, ns.AlterSchema(ctx, `
+		name: string @index(exact) .
+		age: int @index(int) .
+		works_at: uid @reverse .
+	`))
+	_, err = ns.LoadData(ctx, dataFolder, modusdb.LoadOptions{
+		CSV: map[string]modusdb.CSVMapping{
+			"people": {
+				Subject: "id",
+				Type:    "Person",
+				Columns: map[string]modusdb.CSVColumn{
+					"name":     {Predicate: "name"},
+					"age":      {Predicate: "age", Type: modusdb.CSVInt},
+					"employer": {Predicate: "works_at", Ref: "companies"},
+				},
+			},
+			"companies": {Subject: "key"},
+		},
+	})
+	require.NoError(t, err)
+
+	resp, err := ns.Query(ctx, `{
+		companies(func: type(Person), orderasc: name) @normalize {
+			person: name
+			age: age
+			works_at { company: name }
+		}
+		acme(func: eq(name, "Acme")) {
+			count(~works_at)
+		}
+	}`)
+	require.NoError(t, err)
+	require.JSONEq(t, `{
+		"companies": [
+			{"person": "Alice", "age": 34, "company": "Acme"},
+			{"person": "Bob, Jr.", "age": 27, "company": "Acme"},
+			{"person": "Carol", "company": "Globex"}
+		],
+		"acme": [{"count(~works_at)": 2}]
+	}`, string(resp.Json))
+
+	// every CSV file needs a mapping
+	_, err = ns.LoadData(ctx, dataFolder)
+	require.Error(t, err)
+}
+
+func TestLiveLoaderOptions(t *testing.T) {
+	ctx := context.Background()
+	engine, err := modusdb.NewEngine(modusdb.NewDefaultConfig(t.TempDir()))
+	require.NoError(t, err)
+	defer engine.Close()
+
+	dataFolder := t.TempDir()
+	require.NoError(t, os.WriteFile(filepath.Join(dataFolder, "data.rdf"), []byte(SmallData), 0600))
+	badFile := filepath.Join(dataFolder, "bad.rdf")
+	require.NoError(t, os.WriteFile(badFile, []byte(`<0x1> <name> "unterminated .`), 0600))
+
+	ns := engine.GetDefaultNamespace()
+	require.NoError(t, ns.AlterSchema(ctx, DbSchema))
+
+	_, err = ns.LoadData(ctx, dataFolder)
+	require.Error(t, err)
+
+	var progress []modusdb.LoadProgress
+	summary, err := ns.LoadData(ctx, dataFolder, modusdb.LoadOptions{
+		Concurrency:      1,
+		BatchSize:        2,
+		ProgressInterval: time.Millisecond,
+		Progress: func(p modusdb.LoadProgress) {
+			progress = append(progress, p)
+		},
+		OnFileError: modusdb.LoadErrorSkip,
+	})
+	require.NoError(t, err)
+	require.Equal(t, 1, summary.Files)
+	require.Equal(t, 11, summary.NQuads)
+	require.Len(t, summary.SkippedFiles, 1)
+	require.Contains(t, summary.SkippedFiles, badFile)
+	for _, p := range progress {
+		require.LessOrEqual(t, p.NQuads, summary.NQuads)
+	}
+}
+
+func TestLiveLoaderCheckpoint(t *testing.T) {
+	ctx := context.Background()
+	engine, err := modusdb.NewEngine(modusdb.NewDefaultConfig(t.TempDir()))
+	require.NoError(t, err)
+	defer engine.Close()
+
+	dataFolder := t.TempDir()
+	peopleFile := filepath.Join(dataFolder, "people.csv")
+	people := "id,name,age,employer\n1,Alice,34,10\n2,Bob,27,10\n3,Carol,%s,11\n4,Dan,45,11\n"
+	require.NoError(t, os.WriteFile(peopleFile, []byte(fmt.Sprintf(people, "not-a-number")), 0600))
+	require.NoError(t, os.WriteFile(filepath.Join(dataFolder, "companies.csv"),
+		[]byte("key,name\n10,Acme\n11,Globex\n"), 0600))
+
+	ns := engine.GetDefaultNamespace()
+	require.NoError(t, ns.AlterSchema(ctx, `
+		name: string @index(exact) .
+		age: int .
+		works_at: uid .
+	`))
+	opts := modusdb.LoadOptions{
+		Concurrency: 1,
+		BatchSize:   2,
+		Checkpoint:  "import",
+		CSV: map[string]modusdb.CSVMapping{
+			"people": {
+				Subject: "id",
+				Type:    "Person",
+				Columns: map[string]modusdb.CSVColumn{
+					"name":     {Predicate: "name"},
+					"age":      {Predicate: "age", Type: modusdb.CSVInt},
+					"employer": {Predicate: "works_at", Ref: "companies"},
+				},
+			},
+			"companies": {Subject: "key", Type: "Company"},
+		},
+	}
+
+	_, err = ns.LoadData(ctx, dataFolder, opts)
+	require.ErrorContains(t, err, "not-a-number")
+
+	// fixing the file and running the load again resumes it
+	require.NoError(t, os.WriteFile(peopleFile, []byte(fmt.Sprintf(people, "52")), 0600))
+	_, err = ns.LoadData(ctx, dataFolder, opts)
+	require.NoError(t, err)
+
+	const query = `{
+		people(func: type(Person)) { count(uid) }
+		companies(func: type(Company)) { count(uid) }
+		globex(func: eq(name, "Globex")) { name }
+		employees(func: type(Person), orderasc: name) @normalize {
+			name: name
+			works_at { company: name }
+		}
+	}`
+	const expected = `{
+		"people": [{"count": 4}],
+		"companies": [{"count": 2}],
+		"globex": [{"name": "Globex"}],
+		"employees": [
+			{"name": "Alice", "company": "Acme"},
+			{"name": "Bob", "company": "Acme"},
+			{"name": "Carol", "company": "Globex"},
+			{"name": "Dan", "company": "Globex"}
+		]
+	}`
+	resp, err := ns.Query(ctx, query)
+	require.NoError(t, err)
+	require.JSONEq(t, expected, string(resp.Json))
+
+	// the files are loaded completely, running the load again does nothing
+	summary, err := ns.LoadData(ctx, dataFolder, opts)
+	require.NoError(t, err)
+	require.Zero(t, summary.NQuads)
+	resp, err = ns.Query(ctx, query)
+	require.NoError(t, err)
+	require.JSONEq(t, expected, string(resp.Json))
+
+	// without the checkpoint, the data is loaded again as new nodes
+	require.NoError(t, ns.DeleteLoadCheckpoint("import"))
+	_, err = ns.LoadData(ctx, dataFolder, opts)
+	require.NoError(t, err)
+	resp, err = ns.Query(ctx, `{ people(func: type(Person)) { count(uid) } }`)
+	require.NoError(t, err)
+	require.JSONEq(t, `{"people": [{"count": 8}]}`, string(resp.Json))
+
+	// the objects of JSON files get random blank node names, they cannot be resumed
+	require.NoError(t, os.WriteFile(filepath.Join(dataFolder, "more.json"),
+		[]byte(`[{"name": "Eve", "dgraph.type": "Person"}]`), 0600))
+	_, err = ns.LoadData(ctx, dataFolder, opts)
+	require.ErrorContains(t, err, "cannot be loaded with a checkpoint")
+}
@@ -21,20 +21,122 @@ func (ns *Namespace) ID() uint64 {
 	return ns.id
 }
 
+// Name returns the name of the namespace, empty if it was never given one.
+func (ns *Namespace) Name() string {
+	return ns.engine.z.namespaceMetadata(ns.id).Name
+}
+
+// Labels returns a copy of the labels the namespace was created with.
+func (ns *Namespace) Labels() map[string]string {
+	return ns.engine.z.namespaceMetadata(ns.id).Labels
+}
+
+// Rename changes the name of the namespace, the new name must not be used
+// by any other namespace.
+func (ns *Namespace) Rename(name string) error {
+	return ns.engine.renameNamespace(ns, name)
+}
+
+// NamespaceOption configures a namespace created by Engine.CreateNamespace.
+type NamespaceOption func(*namespaceMeta)
+
+func WithNamespaceName(name string) NamespaceOption {
+	return func(m *namespaceMeta) {
+		m.Name = name
+	}
+}
+
+func WithNamespaceLabels(labels map[string]string) NamespaceOption {
+	return func(m *namespaceMeta) {
+		m.Labels = make(map[string]string, len(labels))
+		for k, v := range labels {
+			m.Labels[k] = v
+		}
+	}
+}
+
 // DropData drops all the data in the modusDB instance.
 func (ns *Namespace) DropData(ctx context.Context) error {
 	return ns.engine.dropData(ctx, ns)
 }
 
+// DropPredicate drops the predicate from the schema of the namespace along with
+// all its data and indexes. The types using the predicate are left unchanged.
+// Pre-defined predicates, such as dgraph.type, cannot be dropped. It fails if
+// a transaction that wrote to the predicate is still pending.
+func (ns *Namespace) DropPredicate(ctx context.Context, pred string) error {
+	return ns.engine.dropPredicate(ctx, ns, pred)
+}
+
+// DropType drops the type from the schema of the namespace. Its predicates and
+// their data are kept. Pre-defined types cannot be dropped.
+func (ns *Namespace) DropType(ctx context.Context, typeName string) error {
+	return ns.engine.dropType(ctx, ns, typeName)
+}
+
 func (ns *Namespace) AlterSchema(ctx context.Context, sch string) error {
 	return ns.engine.alterSchema(ctx, ns, sch)
 }
 
+// Mutate applies the mutations in a new transaction and returns the UIDs assigned to
+// the blank nodes, keyed by their names, e.g. "_:alice".
+//
+// The N-Quads in Set and SetNquads, or the objects in SetJson, are added, while those
+// in Del, DelNquads or DeleteJson are removed before any of them is added. To delete,
+// the object can also be the value * to remove every value of the predicate of the
+// subject, as in `<0x1> <name> * .`, and the predicate can be * as well to remove all
+// the predicates of the subject, as in `<0x1> * * .`. The latter only removes the
+// predicates of the types of the subject, given by its dgraph.type.
 func (ns *Namespace) Mutate(ctx context.Context, ms []*api.Mutation) (map[string]uint64, error) {
+	res, err := ns.engine.mutate(ctx, ns, ms)
+	if err != nil {
+		return nil, err
+	}
+	return res.Uids, nil
+}
+
+// MutateWithResult applies the mutations as Mutate does, and returns the UIDs assigned
+// to the blank nodes along with the timestamp the transaction was committed at and the
+// latency of the mutations.
+func (ns *Namespace) MutateWithResult(ctx context.Context, ms []*api.Mutation) (*MutationResult, error) {
 	return ns.engine.mutate(ctx, ns, ms)
 }
 
+// Upsert runs the query and applies the mutations, which can use the variables
+// of the query and be conditional, in a single transaction. See Txn.Upsert.
+func (ns *Namespace) Upsert(ctx context.Context, query string,
+	ms []*api.Mutation) (*api.Response, map[string]uint64, error) {
+	resp, res, err := ns.engine.upsert(ctx, ns, query, ms)
+	if err != nil {
+		return nil, nil, err
+	}
+	return resp, res.Uids, nil
+}
+
+// UpsertWithResult runs the upsert as Upsert does, and returns the typed results of the
+// query and the mutations. The result of the query is read at the StartTs of the
+// mutation result.
+func (ns *Namespace) UpsertWithResult(ctx context.Context, query string,
+	ms []*api.Mutation) (*QueryResult, *MutationResult, error) {
+	resp, res, err := ns.engine.upsert(ctx, ns, query, ms)
+	if err != nil {
+		return nil, nil, err
+	}
+	return queryResultFromResponse(resp), res, nil
+}
+
 // Query performs query or mutation or upsert on the given modusDB instance.
 func (ns *Namespace) Query(ctx context.Context, query string) (*api.Response, error) {
 	return ns.engine.query(ctx, ns, query)
 }
+
+// QueryWithResult runs a DQL query on the latest committed data of the namespace. The
+// result has the timestamp the data was read at, any mutation committed at or before
+// it is visible to the query.
+func (ns *Namespace) QueryWithResult(ctx context.Context, query string) (*QueryResult, error) {
+	resp, err := ns.engine.query(ctx, ns, query)
+	if err != nil {
+		return nil, err
+	}
+	return queryResultFromResponse(resp), nil
+}
@@ -0,0 +1,185 @@
+/*
+ * SPDX-FileCopyrightText: © Hypermode Inc. <hello@hypermode.com>
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package modusdb
+
+import (
+	"fmt"
+	"strconv"
+	"sync"
+)
+
+// oracle does the conflict detection that Dgraph Zero does in a cluster. The posting
+// package tracks the conflict keys touched by each transaction, and the oracle keeps
+// the last commit timestamp of every key so that a transaction can be aborted if one
+// of its keys was committed by another transaction after it started.
+type oracle struct {
+	sync.Mutex
+
+	// commits maps a conflict key fingerprint to the latest commitTs that wrote it.
+	commits map[uint64]uint64
+	// pending holds the start timestamps of read-write transactions that are still open.
+	pending map[uint64]struct{}
+	// snapshots counts the open read-only transactions at each read timestamp.
+	snapshots map[uint64]int
+
+	maxCommitTs uint64
+
+	// discardTs is the timestamp below which badger is allowed to drop the older
+	// versions of the keys during compaction. It never goes past an open transaction.
+	discardTs    uint64
+	setDiscardTs func(uint64)
+}
+
+func newOracle(readTs uint64, setDiscardTs func(uint64)) *oracle {
+	setDiscardTs(readTs)
+	return &oracle{
+		commits:      make(map[uint64]uint64),
+		pending:      make(map[uint64]struct{}),
+		snapshots:    make(map[uint64]int),
+		maxCommitTs:  readTs,
+		discardTs:    readTs,
+		setDiscardTs: setDiscardTs,
+	}
+}
+
+// readTs returns the timestamp at which all the committed data is visible.
+func (o *oracle) readTs() uint64 {
+	o.Lock()
+	defer o.Unlock()
+	return o.maxCommitTs
+}
+
+// register gets a start timestamp for a new read-write transaction and tracks it
+// as pending. Both happen under the lock, so that no commit can move discardTs past
+// the start timestamp before it is registered.
+func (o *oracle) register(nextTs func() (uint64, error)) (uint64, error) {
+	o.Lock()
+	defer o.Unlock()
+	startTs, err := nextTs()
+	if err != nil {
+		return 0, err
+	}
+	o.pending[startTs] = struct{}{}
+	return startTs, nil
+}
+
+// done marks the transaction as finished and forgets the commits that can no
+// longer conflict with any of the open transactions.
+func (o *oracle) done(startTs uint64) {
+	o.Lock()
+	defer o.Unlock()
+
+	delete(o.pending, startTs)
+	defer o.advanceDiscardTsWithLock()
+	if len(o.pending) == 0 {
+		o.commits = make(map[uint64]uint64)
+		return
+	}
+
+	minStartTs := uint64(0)
+	for ts := range o.pending {
+		if minStartTs == 0 || ts < minStartTs {
+			minStartTs = ts
+		}
+	}
+	for key, commitTs := range o.commits {
+		if commitTs <= minStartTs {
+			delete(o.commits, key)
+		}
+	}
+}
+
+// pin returns the latest read timestamp and keeps the data visible at
+// it from being compacted away until unpin is called.
+func (o *oracle) pin() uint64 {
+	o.Lock()
+	defer o.Unlock()
+	o.snapshots[o.maxCommitTs]++
+	return o.maxCommitTs
+}
+
+// pinAt is like pin, but for a snapshot at an older timestamp. It fails if the
+// timestamp is in the future or if the data at the timestamp may have been compacted.
+func (o *oracle) pinAt(readTs uint64) error {
+	o.Lock()
+	defer o.Unlock()
+	if readTs > o.maxCommitTs || readTs < o.discardTs {
+		return fmt.Errorf("%w: %d is outside [%d, %d]", ErrSnapshotUnavailable,
+			readTs, o.discardTs, o.maxCommitTs)
+	}
+	o.snapshots[readTs]++
+	return nil
+}
+
+func (o *oracle) unpin(readTs uint64) {
+	o.Lock()
+	defer o.Unlock()
+	o.snapshots[readTs]--
+	if o.snapshots[readTs] <= 0 {
+		delete(o.snapshots, readTs)
+	}
+	o.advanceDiscardTsWithLock()
+}
+
+// advanceDiscardTsWithLock moves discardTs up to the oldest timestamp
+// that is still being read by any open transaction.
+func (o *oracle) advanceDiscardTsWithLock() {
+	ts := o.maxCommitTs
+	for readTs := range o.snapshots {
+		ts = min(ts, readTs)
+	}
+	for startTs := range o.pending {
+		ts = min(ts, startTs)
+	}
+	if ts > o.discardTs {
+		o.discardTs = ts
+		o.setDiscardTs(ts)
+	}
+}
+
+// hasOpenTxns returns whether any read-write or read-only transaction is still open.
+func (o *oracle) hasOpenTxns() bool {
+	o.Lock()
+	defer o.Unlock()
+	return len(o.pending) != 0 || len(o.snapshots) != 0
+}
+
+func (o *oracle) hasConflict(startTs uint64, keys []uint64) bool {
+	o.Lock()
+	defer o.Unlock()
+	for _, key := range keys {
+		if commitTs, ok := o.commits[key]; ok && commitTs > startTs {
+			return true
+		}
+	}
+	return false
+}
+
+func (o *oracle) commit(commitTs uint64, keys []uint64) {
+	o.Lock()
+	defer o.Unlock()
+	for _, key := range keys {
+		o.commits[key] = commitTs
+	}
+	if commitTs > o.maxCommitTs {
+		o.maxCommitTs = commitTs
+	}
+	o.advanceDiscardTsWithLock()
+}
+
+// parseConflictKeys converts the keys filled in api.TxnContext by the posting
+// package back to their fingerprints.
+func parseConflictKeys(keys []string) ([]uint64, error) {
+	fps := make([]uint64, 0, len(keys))
+	for _, key := range keys {
+		fp, err := strconv.ParseUint(key, 36, 64)
+		if err != nil {
+			return nil, err
+		}
+		fps = append(fps, fp)
+	}
+	return fps, nil
+}
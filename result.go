@@ -0,0 +1,62 @@
+/*
+ * SPDX-FileCopyrightText: © Hypermode Inc. <hello@hypermode.com>
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package modusdb
+
+import (
+	"time"
+
+	"github.com/dgraph-io/dgo/v240/protos/api"
+)
+
+// Latency is the time spent on each stage of a query or a mutation.
+type Latency struct {
+	Parsing    time.Duration
+	Processing time.Duration
+	// Encoding is the time spent encoding the result of a query to JSON, always
+	// zero for mutations
+	Encoding time.Duration
+	Total    time.Duration
+}
+
+func latencyFromProto(l *api.Latency) Latency {
+	if l == nil {
+		return Latency{}
+	}
+	return Latency{
+		Parsing:    time.Duration(l.GetParsingNs()),
+		Processing: time.Duration(l.GetProcessingNs()),
+		Encoding:   time.Duration(l.GetEncodingNs()),
+		Total:      time.Duration(l.GetTotalNs()),
+	}
+}
+
+// QueryResult is the result of a query along with the timestamp it read the data at.
+type QueryResult struct {
+	Json    []byte
+	ReadTs  uint64
+	Latency Latency
+}
+
+// MutationResult is the result of mutations, see Namespace.MutateWithResult and
+// Txn.MutateWithResult.
+type MutationResult struct {
+	// Uids are the UIDs assigned to the blank nodes, keyed by their names
+	Uids    map[string]uint64
+	StartTs uint64
+	// CommitTs is the timestamp at which the mutations were committed, the queries
+	// reading at CommitTs or later see them. It is zero if nothing was written, and for
+	// the mutations of a transaction, which is committed later, see Txn.CommitTs.
+	CommitTs uint64
+	Latency  Latency
+}
+
+func queryResultFromResponse(resp *api.Response) *QueryResult {
+	return &QueryResult{
+		Json:    resp.GetJson(),
+		ReadTs:  resp.GetTxn().GetStartTs(),
+		Latency: latencyFromProto(resp.GetLatency()),
+	}
+}
@@ -0,0 +1,497 @@
+/*
+ * SPDX-FileCopyrightText: © Hypermode Inc. <hello@hypermode.com>
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package modusdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sync"
+	"time"
+
+	"github.com/dgraph-io/dgo/v240/protos/api"
+	"github.com/hypermodeinc/dgraph/v24/dql"
+	"github.com/hypermodeinc/dgraph/v24/edgraph"
+	"github.com/hypermodeinc/dgraph/v24/posting"
+	"github.com/hypermodeinc/dgraph/v24/protos/pb"
+	"github.com/hypermodeinc/dgraph/v24/query"
+	"github.com/hypermodeinc/dgraph/v24/worker"
+	"github.com/hypermodeinc/dgraph/v24/x"
+)
+
+var (
+	ErrTxnFinished         = errors.New("transaction has already been committed or discarded")
+	ErrTxnAborted          = errors.New("transaction has been aborted due to a conflict, please retry")
+	ErrReadOnlyTxn         = errors.New("mutations are not allowed in a read-only transaction")
+	ErrSnapshotUnavailable = errors.New("no snapshot is available at the requested timestamp")
+)
+
+// applyCommitted writes the mutations of committed transactions, replaced in tests.
+var applyCommitted = worker.ApplyCommited
+
+// Txn is a transaction on a namespace. Mutations done within the transaction are
+// visible to the queries run on the same transaction, and are visible to everyone
+// else only once the transaction is committed.
+//
+// A Txn is safe for concurrent use. Queries run in parallel, while mutations
+// and commits on the same transaction are serialized.
+type Txn struct {
+	// mutex is held for reading by queries and for writing by everything else,
+	// methods with the WithLock suffix expect it to be held by the caller along
+	// with the engine mutex.
+	mutex   sync.RWMutex
+	ns      *Namespace
+	startTs uint64
+
+	// readOnly transactions only read data at startTs, the snapshot is pinned in the
+	// oracle until the transaction is discarded
+	readOnly bool
+	finished bool
+	// commitTs is set once the transaction is committed, it stays zero when the
+	// transaction did not write anything
+	commitTs uint64
+}
+
+// TxnOption configures a read-only transaction.
+type TxnOption func(*txnOptions)
+
+type txnOptions struct {
+	readTs uint64
+}
+
+// AtTimestamp makes the read-only transaction read the data as of the given
+// timestamp, e.g. the StartTs of an earlier transaction, instead of the latest
+// committed data. The timestamp must still be pinned by an open transaction
+// or be the latest read timestamp, otherwise ErrSnapshotUnavailable is returned.
+func AtTimestamp(ts uint64) TxnOption {
+	return func(o *txnOptions) {
+		o.readTs = ts
+	}
+}
+
+type txnCtxKey struct{}
+
+// ContextWithTxn returns a copy of ctx that carries the transaction. The typed API
+// (Create, Upsert, Get, Query and Delete) runs within the transaction attached to
+// the context instead of starting one of its own.
+func ContextWithTxn(ctx context.Context, txn *Txn) context.Context {
+	return context.WithValue(ctx, txnCtxKey{}, txn)
+}
+
+func txnFromContext(ctx context.Context) *Txn {
+	txn, _ := ctx.Value(txnCtxKey{}).(*Txn)
+	return txn
+}
+
+// NewTxn starts a new read-write transaction on the namespace.
+// The transaction must be finished by calling either Commit or Discard.
+func (ns *Namespace) NewTxn() (*Txn, error) {
+	ns.engine.mutex.RLock()
+	defer ns.engine.mutex.RUnlock()
+
+	return ns.newTxnWithLock()
+}
+
+func (ns *Namespace) newTxnWithLock() (*Txn, error) {
+	if !ns.engine.isOpen.Load() {
+		return nil, ErrClosedEngine
+	}
+	if !ns.engine.z.namespaceExists(ns.ID()) {
+		return nil, ErrNonExistentDB
+	}
+
+	startTs, err := ns.engine.o.register(ns.engine.z.nextTs)
+	if err != nil {
+		return nil, err
+	}
+	return &Txn{ns: ns, startTs: startTs}, nil
+}
+
+// NewReadOnlyTxn starts a read-only transaction on the namespace. All the queries
+// run within the transaction read the same snapshot of the data. The snapshot is
+// kept from being compacted away until the transaction is discarded, so Discard
+// must always be called once the transaction is no longer needed.
+func (ns *Namespace) NewReadOnlyTxn(opts ...TxnOption) (*Txn, error) {
+	ns.engine.mutex.RLock()
+	defer ns.engine.mutex.RUnlock()
+
+	if !ns.engine.isOpen.Load() {
+		return nil, ErrClosedEngine
+	}
+	if !ns.engine.z.namespaceExists(ns.ID()) {
+		return nil, ErrNonExistentDB
+	}
+
+	txnOpts := &txnOptions{}
+	for _, opt := range opts {
+		opt(txnOpts)
+	}
+	if txnOpts.readTs == 0 {
+		return ns.newReadOnlyTxnWithLock(), nil
+	}
+
+	if err := ns.engine.o.pinAt(txnOpts.readTs); err != nil {
+		return nil, err
+	}
+	return &Txn{ns: ns, startTs: txnOpts.readTs, readOnly: true}, nil
+}
+
+// newReadOnlyTxnWithLock returns a transaction that reads the latest committed data.
+func (ns *Namespace) newReadOnlyTxnWithLock() *Txn {
+	return &Txn{ns: ns, startTs: ns.engine.o.pin(), readOnly: true}
+}
+
+// StartTs returns the timestamp at which the transaction reads the data.
+func (txn *Txn) StartTs() uint64 {
+	return txn.startTs
+}
+
+// CommitTs returns the timestamp at which the transaction was committed. Queries
+// run at this timestamp or later see the data written by the transaction. It is
+// zero until the transaction is committed, and stays zero if nothing was written.
+func (txn *Txn) CommitTs() uint64 {
+	txn.mutex.RLock()
+	defer txn.mutex.RUnlock()
+	return txn.commitTs
+}
+
+func (txn *Txn) ReadOnly() bool {
+	return txn.readOnly
+}
+
+func (txn *Txn) Namespace() *Namespace {
+	return txn.ns
+}
+
+// Query runs a DQL query within the transaction.
+func (txn *Txn) Query(ctx context.Context, q string) (*api.Response, error) {
+	txn.ns.engine.mutex.RLock()
+	defer txn.ns.engine.mutex.RUnlock()
+	txn.mutex.RLock()
+	defer txn.mutex.RUnlock()
+
+	return txn.queryWithLock(ctx, q)
+}
+
+// QueryWithResult runs a DQL query within the transaction as Query does, and returns
+// its result with the timestamp the data was read at and the latency of the query.
+func (txn *Txn) QueryWithResult(ctx context.Context, q string) (*QueryResult, error) {
+	resp, err := txn.Query(ctx, q)
+	if err != nil {
+		return nil, err
+	}
+	return queryResultFromResponse(resp), nil
+}
+
+func (txn *Txn) queryWithLock(ctx context.Context, q string) (*api.Response, error) {
+	return txn.queryWithVarsLock(ctx, q, nil)
+}
+
+// queryWithVarsLock runs the query with the values of its parameters keyed by name.
+func (txn *Txn) queryWithVarsLock(ctx context.Context, q string, vars map[string]string) (*api.Response, error) {
+	if !txn.ns.engine.isOpen.Load() {
+		return nil, ErrClosedEngine
+	}
+	if txn.finished {
+		return nil, ErrTxnFinished
+	}
+	if !txn.ns.engine.z.namespaceExists(txn.ns.ID()) {
+		return nil, ErrNonExistentDB
+	}
+
+	ctx = x.AttachNamespace(ctx, txn.ns.ID())
+	resp, err := (&edgraph.Server{}).QueryNoAuth(ctx, &api.Request{
+		ReadOnly: true,
+		Query:    q,
+		Vars:     vars,
+		StartTs:  txn.startTs,
+	})
+	if err != nil {
+		return nil, err
+	}
+	// the context is left empty for schema queries and empty queries
+	if resp.Txn == nil {
+		resp.Txn = &api.TxnContext{}
+	}
+	resp.Txn.StartTs = txn.startTs
+	return resp, nil
+}
+
+// Mutate applies the mutations within the transaction and returns the UIDs
+// assigned to the blank nodes.
+func (txn *Txn) Mutate(ctx context.Context, ms []*api.Mutation) (map[string]uint64, error) {
+	if len(ms) == 0 {
+		return nil, nil
+	}
+
+	txn.ns.engine.mutex.RLock()
+	defer txn.ns.engine.mutex.RUnlock()
+	txn.mutex.Lock()
+	defer txn.mutex.Unlock()
+
+	return txn.mutateWithLock(ctx, ms)
+}
+
+// MutateWithResult applies the mutations within the transaction as Mutate does, and
+// returns the UIDs assigned to the blank nodes along with the latency of the mutations.
+// The CommitTs of the result is zero, it is returned by CommitTs once the transaction
+// is committed.
+func (txn *Txn) MutateWithResult(ctx context.Context, ms []*api.Mutation) (*MutationResult, error) {
+	if len(ms) == 0 {
+		return &MutationResult{StartTs: txn.startTs}, nil
+	}
+
+	start := time.Now()
+	dms, err := parseMutations(ms)
+	if err != nil {
+		return nil, err
+	}
+	parsing := time.Since(start)
+
+	txn.ns.engine.mutex.RLock()
+	defer txn.ns.engine.mutex.RUnlock()
+	txn.mutex.Lock()
+	defer txn.mutex.Unlock()
+
+	newUids, err := txn.mutateParsedWithLock(ctx, dms)
+	if err != nil {
+		return nil, err
+	}
+	total := time.Since(start)
+	return &MutationResult{
+		Uids:    newUids,
+		StartTs: txn.startTs,
+		Latency: Latency{Parsing: parsing, Processing: total - parsing, Total: total},
+	}, nil
+}
+
+func (txn *Txn) mutateWithLock(ctx context.Context, ms []*api.Mutation) (map[string]uint64, error) {
+	if txn.readOnly {
+		return nil, ErrReadOnlyTxn
+	}
+
+	dms, err := parseMutations(ms)
+	if err != nil {
+		return nil, err
+	}
+	return txn.mutateParsedWithLock(ctx, dms)
+}
+
+func parseMutations(ms []*api.Mutation) ([]*dql.Mutation, error) {
+	dms := make([]*dql.Mutation, 0, len(ms))
+	for _, mu := range ms {
+		dm, err := edgraph.ParseMutationObject(mu, false)
+		if err != nil {
+			return nil, fmt.Errorf("error parsing mutation: %w", err)
+		}
+		dms = append(dms, dm)
+	}
+	return dms, nil
+}
+
+// mutateParsedWithLock assigns UIDs to the blank nodes of the parsed mutations
+// and applies them within the transaction.
+func (txn *Txn) mutateParsedWithLock(ctx context.Context, dms []*dql.Mutation) (map[string]uint64, error) {
+	if txn.readOnly {
+		return nil, ErrReadOnlyTxn
+	}
+
+	newUids, err := txn.ns.engine.assignBlankUIDs(ctx, dms)
+	if err != nil {
+		return nil, err
+	}
+
+	if err := txn.mutateWithDqlMutation(ctx, dms, newUids); err != nil {
+		return nil, err
+	}
+	return newUids, nil
+}
+
+// assignBlankUIDs returns new UIDs for the blank nodes of the mutations.
+func (engine *Engine) assignBlankUIDs(ctx context.Context, dms []*dql.Mutation) (map[string]uint64, error) {
+	newUids, err := query.ExtractBlankUIDs(ctx, dms)
+	if err != nil {
+		return nil, err
+	}
+	if len(newUids) > 0 {
+		num := &pb.Num{Val: uint64(len(newUids)), Type: pb.Num_UID}
+		res, err := engine.z.nextUIDs(num)
+		if err != nil {
+			return nil, err
+		}
+
+		curId := res.StartId
+		for k := range newUids {
+			x.AssertTruef(curId != 0 && curId <= res.EndId, "not enough uids generated")
+			newUids[k] = curId
+			curId++
+		}
+	}
+	return newUids, nil
+}
+
+func (txn *Txn) mutateWithDqlMutation(ctx context.Context, dms []*dql.Mutation,
+	newUids map[string]uint64) error {
+	edges, err := query.ToDirectedEdges(dms, newUids)
+	if err != nil {
+		return fmt.Errorf("error converting to directed edges: %w", err)
+	}
+	ctx = x.AttachNamespace(ctx, txn.ns.ID())
+
+	if !txn.ns.engine.isOpen.Load() {
+		return ErrClosedEngine
+	}
+	if txn.finished {
+		return ErrTxnFinished
+	}
+	if txn.readOnly {
+		return ErrReadOnlyTxn
+	}
+
+	m := &pb.Mutations{
+		GroupId: 1,
+		StartTs: txn.startTs,
+		Edges:   edges,
+	}
+
+	m.Edges, err = query.ExpandEdges(ctx, m)
+	if err != nil {
+		return fmt.Errorf("error expanding edges: %w", err)
+	}
+
+	for _, edge := range m.Edges {
+		worker.InitTablet(edge.Attr)
+	}
+
+	p := &pb.Proposal{Mutations: m, StartTs: txn.startTs}
+	if err := worker.ApplyMutations(ctx, p); err != nil {
+		if errors.Is(err, x.ErrConflict) {
+			return ErrTxnAborted
+		}
+		return err
+	}
+	return nil
+}
+
+// Commit commits the transaction. ErrTxnAborted is returned if any of the data
+// written by the transaction was committed by another transaction in the meantime.
+func (txn *Txn) Commit(ctx context.Context) error {
+	txn.ns.engine.mutex.RLock()
+	defer txn.ns.engine.mutex.RUnlock()
+	txn.mutex.Lock()
+	defer txn.mutex.Unlock()
+
+	return txn.commitWithLock(ctx)
+}
+
+func (txn *Txn) commitWithLock(ctx context.Context) error {
+	if txn.finished {
+		return ErrTxnFinished
+	}
+	if txn.readOnly {
+		return ErrReadOnlyTxn
+	}
+	txn.finished = true
+	defer txn.ns.engine.o.done(txn.startTs)
+
+	if !txn.ns.engine.isOpen.Load() {
+		return ErrClosedEngine
+	}
+	if !txn.ns.engine.z.namespaceExists(txn.ns.ID()) {
+		return txn.abort(ctx, ErrNonExistentDB)
+	}
+
+	ptxn := posting.Oracle().GetTxn(txn.startTs)
+	if ptxn == nil {
+		// nothing was written by the transaction
+		return nil
+	}
+	if ptxn.ShouldAbort() {
+		return txn.abort(ctx, ErrTxnAborted)
+	}
+
+	tctx := &api.TxnContext{}
+	ptxn.FillContext(tctx, 1, false)
+	keys, err := parseConflictKeys(tctx.Keys)
+	if err != nil {
+		return txn.abort(ctx, fmt.Errorf("error parsing conflict keys: %w", err))
+	}
+
+	txn.ns.engine.commitMutex.Lock()
+	defer txn.ns.engine.commitMutex.Unlock()
+	if txn.ns.engine.o.hasConflict(txn.startTs, keys) {
+		return txn.abort(ctx, ErrTxnAborted)
+	}
+
+	commitTs, err := txn.ns.engine.z.nextTs()
+	if err != nil {
+		return txn.abort(ctx, err)
+	}
+	if err := applyCommitted(ctx, &pb.OracleDelta{
+		Txns: []*pb.TxnStatus{{StartTs: txn.startTs, CommitTs: commitTs}},
+	}); err != nil {
+		// some of the writes may be on disk already, they conflict with the
+		// transactions that read them before the commit timestamp
+		txn.ns.engine.o.commit(commitTs, keys)
+		return fmt.Errorf("error committing transaction: %w", err)
+	}
+
+	txn.ns.engine.o.commit(commitTs, keys)
+	txn.commitTs = commitTs
+	return nil
+}
+
+// Discard drops all the mutations done within the transaction, or releases the
+// snapshot of a read-only transaction. Calling Discard after the transaction is
+// committed is a no-op.
+func (txn *Txn) Discard(ctx context.Context) error {
+	txn.ns.engine.mutex.RLock()
+	defer txn.ns.engine.mutex.RUnlock()
+	txn.mutex.Lock()
+	defer txn.mutex.Unlock()
+
+	return txn.discardWithLock(ctx)
+}
+
+func (txn *Txn) discardWithLock(ctx context.Context) error {
+	if txn.finished {
+		return nil
+	}
+	if txn.readOnly {
+		txn.release()
+		return nil
+	}
+	txn.finished = true
+	defer txn.ns.engine.o.done(txn.startTs)
+
+	if !txn.ns.engine.isOpen.Load() {
+		return ErrClosedEngine
+	}
+	return txn.abort(ctx, nil)
+}
+
+// release unpins the snapshot of a read-only transaction.
+func (txn *Txn) release() {
+	if txn.finished {
+		return
+	}
+	txn.finished = true
+	txn.ns.engine.o.unpin(txn.startTs)
+}
+
+func (txn *Txn) abort(ctx context.Context, cause error) error {
+	if posting.Oracle().GetTxn(txn.startTs) == nil {
+		return cause
+	}
+
+	err := worker.ApplyCommited(ctx, &pb.OracleDelta{
+		Txns: []*pb.TxnStatus{{StartTs: txn.startTs}},
+	})
+	if err != nil {
+		return fmt.Errorf("error aborting transaction: %w", err)
+	}
+	return cause
+}
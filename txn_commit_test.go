@@ -0,0 +1,68 @@
+/*
+ * SPDX-FileCopyrightText: © Hypermode Inc. <hello@hypermode.com>
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package modusdb
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/dgraph-io/dgo/v240/protos/api"
+	"github.com/hypermodeinc/dgraph/v24/protos/pb"
+	"github.com/hypermodeinc/dgraph/v24/worker"
+	"github.com/stretchr/testify/require"
+)
+
+func TestTxnCommitApplyError(t *testing.T) {
+	ctx := context.Background()
+	engine, err := NewEngine(NewDefaultConfig(t.TempDir()))
+	require.NoError(t, err)
+	defer engine.Close()
+
+	ns := engine.GetDefaultNamespace()
+	require.NoError(t, ns.AlterSchema(ctx, "name: string @index(exact) ."))
+
+	uids, err := ns.Mutate(ctx, []*api.Mutation{{
+		Set: []*api.NQuad{{
+			Subject:     "_:aman",
+			Predicate:   "name",
+			ObjectValue: &api.Value{Val: &api.Value_StrVal{StrVal: "A"}},
+		}},
+	}})
+	require.NoError(t, err)
+	uid := uids["_:aman"]
+
+	setName := func(txn *Txn, name string) {
+		_, err := txn.Mutate(ctx, []*api.Mutation{{
+			Set: []*api.NQuad{{
+				Subject:     fmt.Sprintf("%#x", uid),
+				Predicate:   "name",
+				ObjectValue: &api.Value{Val: &api.Value_StrVal{StrVal: name}},
+			}},
+		}})
+		require.NoError(t, err)
+	}
+
+	txn1, err := ns.NewTxn()
+	require.NoError(t, err)
+	txn2, err := ns.NewTxn()
+	require.NoError(t, err)
+	setName(txn1, "B")
+	setName(txn2, "C")
+
+	errApply := errors.New("error writing to disk")
+	applyCommitted = func(context.Context, *pb.OracleDelta) error {
+		return errApply
+	}
+	err = txn1.Commit(ctx)
+	applyCommitted = worker.ApplyCommited
+	require.ErrorIs(t, err, errApply)
+
+	// the writes of the failed commit may be on disk, the oracle tracks them
+	require.ErrorIs(t, txn2.Commit(ctx), ErrTxnAborted)
+	require.False(t, engine.o.hasOpenTxns())
+}
@@ -7,10 +7,18 @@ package unit_test
 
 import (
 	"context"
+	"encoding/base64"
+	"encoding/binary"
+	"encoding/json"
 	"fmt"
+	"hash/crc32"
+	"math"
 	"testing"
+	"time"
 
+	"github.com/dgraph-io/dgo/v240/protos/api"
 	"github.com/stretchr/testify/require"
+	"github.com/twpayne/go-geom"
 
 	"github.com/hypermodeinc/modusdb"
 	"github.com/hypermodeinc/modusdb/api/apiutils"
@@ -860,6 +868,7 @@ func TestVectorIndexSearchWithQuery(t *testing.T) {
 	gids, docs, err := modusdb.Query[Document](context.Background(), engine, modusdb.QueryParams{
 		Filter: &modusdb.Filter{
 			Field: "textVec",
+			//nolint:staticcheck
 			Vector: modusdb.VectorPredicate{
 				SimilarTo: []float32{0.1, 0.1, 0.1},
 				TopK:      5,
@@ -876,3 +885,828 @@ func TestVectorIndexSearchWithQuery(t *testing.T) {
 	require.Equal(t, "fox", docs[3].Text)
 	require.Equal(t, "gorilla", docs[4].Text)
 }
+
+type Writer struct {
+	Gid     uint64    `json:"gid,omitempty"`
+	Name    string    `json:"name,omitempty"`
+	ClerkId string    `json:"clerk_id,omitempty" db:"constraint=unique"`
+	Posts   []Article `json:"posts,omitempty" readFrom:"type=Article,field=writer"`
+}
+
+type Article struct {
+	Gid     uint64 `json:"gid,omitempty"`
+	Title   string `json:"title,omitempty" db:"constraint=term"`
+	ClerkId string `json:"clerk_id,omitempty" db:"constraint=unique"`
+	Writer  Writer `json:"writer,omitempty"`
+}
+
+func TestQueryApiWithEdgeParams(t *testing.T) {
+	ctx := context.Background()
+	engine, err := modusdb.NewEngine(modusdb.NewDefaultConfig(t.TempDir()))
+	require.NoError(t, err)
+	defer engine.Close()
+
+	ns1, err := engine.CreateNamespace()
+	require.NoError(t, err)
+
+	for i, name := range []string{"A", "B"} {
+		writerGid, _, err := modusdb.Create(ctx, engine, Writer{
+			Name:    name,
+			ClerkId: fmt.Sprintf("w%d", i),
+		}, ns1.ID())
+		require.NoError(t, err)
+
+		titles := []string{"graph databases", "cooking at home", "graph theory"}
+		if name == "B" {
+			titles = []string{"cooking for two"}
+		}
+		for j, title := range titles {
+			_, _, err := modusdb.Create(ctx, engine, Article{
+				Title:   title,
+				ClerkId: fmt.Sprintf("a%d%d", i, j),
+				Writer:  Writer{Gid: writerGid},
+			}, ns1.ID())
+			require.NoError(t, err)
+		}
+	}
+
+	// the posts of every writer are filtered, sorted and paginated
+	_, writers, err := modusdb.Query[Writer](ctx, engine, modusdb.QueryParams{
+		Sorting: &modusdb.Sorting{OrderAscField: "name"},
+		Edges: map[string]modusdb.QueryParams{
+			"posts": {
+				Filter: &modusdb.Filter{
+					Field:  "title",
+					String: modusdb.StringPredicate{AnyOfTerms: []string{"graph"}},
+				},
+				Sorting:    &modusdb.Sorting{OrderDescField: "title"},
+				Pagination: &modusdb.Pagination{Limit: 1},
+			},
+		},
+	}, ns1.ID())
+	require.NoError(t, err)
+	require.Len(t, writers, 2)
+	require.Len(t, writers[0].Posts, 1)
+	require.Equal(t, "graph theory", writers[0].Posts[0].Title)
+	require.Empty(t, writers[1].Posts)
+
+	// only the writers whose posts mention graph are left with cascade
+	_, writers, err = modusdb.Query[Writer](ctx, engine, modusdb.QueryParams{
+		Cascade:       true,
+		CascadeFields: []string{"posts"},
+		Edges: map[string]modusdb.QueryParams{
+			"posts": {
+				Filter: &modusdb.Filter{
+					Field:  "title",
+					String: modusdb.StringPredicate{AnyOfTerms: []string{"graph"}},
+				},
+			},
+		},
+	}, ns1.ID())
+	require.NoError(t, err)
+	require.Len(t, writers, 1)
+	require.Equal(t, "A", writers[0].Name)
+	require.Len(t, writers[0].Posts, 2)
+
+	// nested edges are fetched when they have parameters
+	_, articles, err := modusdb.Query[Article](ctx, engine, modusdb.QueryParams{
+		Filter: &modusdb.Filter{
+			Field:  "title",
+			String: modusdb.StringPredicate{AllOfTerms: []string{"cooking", "two"}},
+		},
+		Edges: map[string]modusdb.QueryParams{
+			"writer": {Edges: map[string]modusdb.QueryParams{"posts": {}}},
+		},
+	}, ns1.ID())
+	require.NoError(t, err)
+	require.Len(t, articles, 1)
+	require.Equal(t, "B", articles[0].Writer.Name)
+	require.Len(t, articles[0].Writer.Posts, 1)
+
+	_, _, err = modusdb.Query[Writer](ctx, engine, modusdb.QueryParams{
+		Edges: map[string]modusdb.QueryParams{"name": {}},
+	}, ns1.ID())
+	require.Error(t, err)
+}
+
+type Employee struct {
+	Gid     uint64     `json:"gid,omitempty"`
+	Name    string     `json:"name,omitempty"`
+	Manager *Employee  `json:"manager,omitempty"`
+	Reports []Employee `json:"reports,omitempty"`
+}
+
+func TestReadDepthWithSelfReferencingType(t *testing.T) {
+	ctx := context.Background()
+	engine, err := modusdb.NewEngine(modusdb.NewDefaultConfig(t.TempDir()))
+	require.NoError(t, err)
+	defer engine.Close()
+
+	ns1, err := engine.CreateNamespace()
+	require.NoError(t, err)
+	require.NoError(t, ns1.AlterSchema(ctx, `
+		Employee.name: string @index(exact) .
+		Employee.manager: uid .
+		Employee.reports: [uid] .
+		type Employee {
+			Employee.name
+			Employee.manager
+			Employee.reports
+		}
+	`))
+
+	// A manages B, who manages C, who manages D
+	uids, err := ns1.Mutate(ctx, []*api.Mutation{{
+		SetNquads: []byte(`
+			_:a <dgraph.type> "Employee" .
+			_:a <Employee.name> "A" .
+			_:a <Employee.reports> _:b .
+			_:b <dgraph.type> "Employee" .
+			_:b <Employee.name> "B" .
+			_:b <Employee.manager> _:a .
+			_:b <Employee.reports> _:c .
+			_:c <dgraph.type> "Employee" .
+			_:c <Employee.name> "C" .
+			_:c <Employee.manager> _:b .
+			_:c <Employee.reports> _:d .
+			_:d <dgraph.type> "Employee" .
+			_:d <Employee.name> "D" .
+			_:d <Employee.manager> _:c .
+		`),
+	}})
+	require.NoError(t, err)
+
+	// a single level of edges is fetched by default
+	_, d, err := modusdb.Get[Employee](ctx, engine, uids["_:d"], ns1.ID())
+	require.NoError(t, err)
+	require.NotNil(t, d.Manager)
+	require.Equal(t, "C", d.Manager.Name)
+	require.Nil(t, d.Manager.Manager)
+
+	_, d, err = modusdb.Get[Employee](modusdb.ContextWithReadDepth(ctx, 3), engine, uids["_:d"], ns1.ID())
+	require.NoError(t, err)
+	require.Equal(t, "C", d.Manager.Name)
+	require.Equal(t, "B", d.Manager.Manager.Name)
+	require.Equal(t, "A", d.Manager.Manager.Manager.Name)
+	require.Nil(t, d.Manager.Manager.Manager.Manager)
+
+	_, employees, err := modusdb.Query[Employee](ctx, engine, modusdb.QueryParams{
+		Sorting: &modusdb.Sorting{OrderAscField: "name"},
+		Depth:   2,
+	}, ns1.ID())
+	require.NoError(t, err)
+	require.Len(t, employees, 4)
+	a := employees[0]
+	require.Equal(t, "A", a.Name)
+	require.Nil(t, a.Manager)
+	require.Len(t, a.Reports, 1)
+	require.Equal(t, "B", a.Reports[0].Name)
+	require.Len(t, a.Reports[0].Reports, 1)
+	require.Equal(t, "C", a.Reports[0].Reports[0].Name)
+	require.Empty(t, a.Reports[0].Reports[0].Reports)
+}
+
+type Account struct {
+	Gid       uint64    `json:"gid,omitempty"`
+	ClerkId   string    `json:"clerk_id,omitempty" db:"constraint=unique"`
+	Age       int       `json:"age,omitempty"`
+	Score     float64   `json:"score,omitempty"`
+	Active    bool      `json:"active,omitempty"`
+	CreatedAt time.Time `json:"created_at,omitempty"`
+}
+
+func TestQueryApiWithTypedFilters(t *testing.T) {
+	ctx := context.Background()
+	engine, err := modusdb.NewEngine(modusdb.NewDefaultConfig(t.TempDir()))
+	require.NoError(t, err)
+	defer engine.Close()
+
+	ns1, err := engine.CreateNamespace()
+	require.NoError(t, err)
+
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	for i := 0; i < 5; i++ {
+		_, _, err := modusdb.Create(ctx, engine, Account{
+			ClerkId:   fmt.Sprintf("%d", 100+i),
+			Age:       20 + i*10,
+			Score:     float64(i) + 0.5,
+			Active:    i%2 == 0,
+			CreatedAt: start.AddDate(0, i, 0),
+		}, ns1.ID())
+		require.NoError(t, err)
+	}
+
+	query := func(f modusdb.Filter) []Account {
+		_, accounts, err := modusdb.Query[Account](ctx, engine, modusdb.QueryParams{
+			Filter:  &f,
+			Sorting: &modusdb.Sorting{OrderAscField: "age"},
+		}, ns1.ID())
+		require.NoError(t, err)
+		return accounts
+	}
+	ptr := func(v int64) *int64 { return &v }
+
+	accounts := query(modusdb.Filter{Field: "age", Int: modusdb.IntPredicate{GreaterThan: ptr(30)}})
+	require.Len(t, accounts, 3)
+	require.Equal(t, 40, accounts[0].Age)
+
+	accounts = query(modusdb.Filter{Field: "age", Int: modusdb.IntPredicate{
+		GreaterOrEqual: ptr(30),
+		LessThan:       ptr(50),
+	}})
+	require.Len(t, accounts, 2)
+	require.Equal(t, 30, accounts[0].Age)
+	require.Equal(t, 40, accounts[1].Age)
+
+	score := 2.0
+	accounts = query(modusdb.Filter{Field: "score", Float: modusdb.FloatPredicate{LessOrEqual: &score}})
+	require.Len(t, accounts, 2)
+
+	active := true
+	accounts = query(modusdb.Filter{Field: "active", Bool: modusdb.BoolPredicate{Equals: &active}})
+	require.Len(t, accounts, 3)
+
+	from, to := start.AddDate(0, 1, 0), start.AddDate(0, 3, 0)
+	accounts = query(modusdb.Filter{Field: "created_at", Time: modusdb.TimePredicate{
+		AfterOrAt:  &from,
+		BeforeOrAt: &to,
+	}})
+	require.Len(t, accounts, 3)
+	require.True(t, accounts[0].CreatedAt.Equal(from))
+	require.True(t, accounts[2].CreatedAt.Equal(to))
+}
+
+type Store struct {
+	Gid      uint64     `json:"gid,omitempty"`
+	ClerkId  string     `json:"clerk_id,omitempty" db:"constraint=unique"`
+	Name     string     `json:"name,omitempty"`
+	Location geom.Point `json:"location,omitempty" db:"constraint=geo"`
+}
+
+func TestQueryApiWithGeoFilters(t *testing.T) {
+	ctx := context.Background()
+	engine, err := modusdb.NewEngine(modusdb.NewDefaultConfig(t.TempDir()))
+	require.NoError(t, err)
+	defer engine.Close()
+
+	ns1, err := engine.CreateNamespace()
+	require.NoError(t, err)
+
+	stores := []Store{
+		{ClerkId: "1", Name: "A", Location: *geom.NewPointFlat(geom.XY, []float64{-122.40, 37.78})},
+		{ClerkId: "2", Name: "B", Location: *geom.NewPointFlat(geom.XY, []float64{-122.41, 37.77})},
+		{ClerkId: "3", Name: "C", Location: *geom.NewPointFlat(geom.XY, []float64{-73.98, 40.75})},
+	}
+	for _, store := range stores {
+		_, _, err := modusdb.Create(ctx, engine, store, ns1.ID())
+		require.NoError(t, err)
+	}
+
+	query := func(f modusdb.GeoPredicate) []Store {
+		_, stores, err := modusdb.Query[Store](ctx, engine, modusdb.QueryParams{
+			Filter:  &modusdb.Filter{Field: "location", Geo: f},
+			Sorting: &modusdb.Sorting{OrderAscField: "name"},
+		}, ns1.ID())
+		require.NoError(t, err)
+		return stores
+	}
+
+	found := query(modusdb.GeoPredicate{
+		Near:         geom.NewPointFlat(geom.XY, []float64{-122.40, 37.78}),
+		NearDistance: 5000,
+	})
+	require.Len(t, found, 2)
+	require.Equal(t, "A", found[0].Name)
+	require.Equal(t, "B", found[1].Name)
+	require.Equal(t, []float64{-122.40, 37.78}, found[0].Location.FlatCoords())
+
+	sf := geom.NewPolygonFlat(geom.XY, []float64{
+		-122.5, 37.7, -122.3, 37.7, -122.3, 37.8, -122.5, 37.8, -122.5, 37.7,
+	}, []int{10})
+	found = query(modusdb.GeoPredicate{Within: sf})
+	require.Len(t, found, 2)
+
+	nyc := geom.NewPolygonFlat(geom.XY, []float64{
+		-74.1, 40.6, -73.9, 40.6, -73.9, 40.9, -74.1, 40.9, -74.1, 40.6,
+	}, []int{10})
+	both := geom.NewMultiPolygon(geom.XY)
+	require.NoError(t, both.Push(sf))
+	require.NoError(t, both.Push(nyc))
+	found = query(modusdb.GeoPredicate{Within: both})
+	require.Len(t, found, 3)
+}
+
+func TestQueryApiWithFilterTree(t *testing.T) {
+	ctx := context.Background()
+	engine, err := modusdb.NewEngine(modusdb.NewDefaultConfig(t.TempDir()))
+	require.NoError(t, err)
+	defer engine.Close()
+
+	ns1, err := engine.CreateNamespace()
+	require.NoError(t, err)
+
+	for i := 0; i < 6; i++ {
+		_, _, err := modusdb.Create(ctx, engine, Account{
+			ClerkId: fmt.Sprintf("%d", 100+i),
+			Age:     20 + i*10,
+			Active:  i%2 == 0,
+		}, ns1.ID())
+		require.NoError(t, err)
+	}
+
+	query := func(f modusdb.Filter) ([]int, error) {
+		_, accounts, err := modusdb.Query[Account](ctx, engine, modusdb.QueryParams{
+			Filter:  &f,
+			Sorting: &modusdb.Sorting{OrderAscField: "age"},
+		}, ns1.ID())
+		ages := make([]int, len(accounts))
+		for i, a := range accounts {
+			ages[i] = a.Age
+		}
+		return ages, err
+	}
+	ptr := func(v int64) *int64 { return &v }
+	active := true
+	isActive := modusdb.Filter{Field: "active", Bool: modusdb.BoolPredicate{Equals: &active}}
+	olderThan := func(age int64) modusdb.Filter {
+		return modusdb.Filter{Field: "age", Int: modusdb.IntPredicate{GreaterThan: ptr(age)}}
+	}
+	youngerThan := func(age int64) modusdb.Filter {
+		return modusdb.Filter{Field: "age", Int: modusdb.IntPredicate{LessThan: ptr(age)}}
+	}
+
+	// the predicate of the filter is kept along with the deprecated And
+	f := olderThan(30)
+	f.And = &isActive //nolint:staticcheck
+	ages, err := query(f)
+	require.NoError(t, err)
+	require.Equal(t, []int{40, 60}, ages)
+
+	// (age < 30 OR age > 50) AND NOT active
+	ages, err = query(modusdb.AllOf(
+		modusdb.AnyOf(youngerThan(30), olderThan(50)),
+		modusdb.Not(isActive),
+	))
+	require.NoError(t, err)
+	require.Equal(t, []int{70}, ages)
+
+	ages, err = query(modusdb.AnyOf(youngerThan(30), olderThan(60), modusdb.AllOf(olderThan(30), youngerThan(50))))
+	require.NoError(t, err)
+	require.Equal(t, []int{20, 40, 70}, ages)
+
+	_, err = query(modusdb.Filter{Field: "missing", Int: modusdb.IntPredicate{GreaterThan: ptr(1)}})
+	require.Error(t, err)
+	_, err = query(modusdb.AllOf(isActive, modusdb.Filter{Field: "active", Int: modusdb.IntPredicate{Equals: ptr(1)}}))
+	require.Error(t, err)
+	_, err = query(modusdb.Filter{Field: "age"})
+	require.Error(t, err)
+}
+
+func TestCountAndAggregateApi(t *testing.T) {
+	ctx := context.Background()
+	engine, err := modusdb.NewEngine(modusdb.NewDefaultConfig(t.TempDir()))
+	require.NoError(t, err)
+	defer engine.Close()
+
+	ns1, err := engine.CreateNamespace()
+	require.NoError(t, err)
+
+	for i := 0; i < 6; i++ {
+		_, _, err := modusdb.Create(ctx, engine, Account{
+			ClerkId: fmt.Sprintf("%d", 100+i),
+			Age:     20 + i*10,
+			Score:   float64(i) / 2,
+			Active:  i%2 == 0,
+		}, ns1.ID())
+		require.NoError(t, err)
+	}
+
+	count, err := modusdb.Count[Account](ctx, engine, modusdb.QueryParams{}, ns1.ID())
+	require.NoError(t, err)
+	require.Equal(t, int64(6), count)
+
+	olderThan30 := int64(30)
+	count, err = modusdb.Count[Account](ctx, engine, modusdb.QueryParams{
+		Filter: &modusdb.Filter{Field: "age", Int: modusdb.IntPredicate{GreaterThan: &olderThan30}},
+	}, ns1.ID())
+	require.NoError(t, err)
+	require.Equal(t, int64(4), count)
+
+	count, err = modusdb.Count[Account](ctx, engine, modusdb.QueryParams{
+		Pagination: &modusdb.Pagination{Limit: 2},
+	}, ns1.ID())
+	require.NoError(t, err)
+	require.Equal(t, int64(2), count)
+
+	aggs, err := modusdb.Aggregate[Account](ctx, engine, modusdb.AggregateParams{Field: "age"}, ns1.ID())
+	require.NoError(t, err)
+	require.Len(t, aggs, 1)
+	require.Nil(t, aggs[0].Group)
+	require.Equal(t, int64(6), aggs[0].Count)
+	require.Equal(t, 20.0, aggs[0].Min)
+	require.Equal(t, 70.0, aggs[0].Max)
+	require.Equal(t, 270.0, aggs[0].Sum)
+	require.Equal(t, 45.0, aggs[0].Avg)
+
+	aggs, err = modusdb.Aggregate[Account](ctx, engine, modusdb.AggregateParams{
+		Field:   "age",
+		GroupBy: []string{"active"},
+	}, ns1.ID())
+	require.NoError(t, err)
+	require.Len(t, aggs, 2)
+	for _, agg := range aggs {
+		require.Equal(t, int64(3), agg.Count)
+		if agg.Group["active"] == true {
+			require.Equal(t, 20.0, agg.Min)
+			require.Equal(t, 60.0, agg.Max)
+			require.Equal(t, 40.0, agg.Avg)
+		} else {
+			require.Equal(t, false, agg.Group["active"])
+			require.Equal(t, 30.0, agg.Min)
+			require.Equal(t, 150.0, agg.Sum)
+		}
+	}
+
+	aggs, err = modusdb.Aggregate[Account](ctx, engine, modusdb.AggregateParams{
+		GroupBy: []string{"age"},
+	}, ns1.ID())
+	require.NoError(t, err)
+	require.Len(t, aggs, 6)
+	for _, agg := range aggs {
+		require.IsType(t, 0, agg.Group["age"])
+		require.Equal(t, int64(1), agg.Count)
+	}
+
+	_, err = modusdb.Aggregate[Account](ctx, engine, modusdb.AggregateParams{Field: "active"}, ns1.ID())
+	require.Error(t, err)
+}
+
+func TestQueryPageApi(t *testing.T) {
+	ctx := context.Background()
+	engine, err := modusdb.NewEngine(modusdb.NewDefaultConfig(t.TempDir()))
+	require.NoError(t, err)
+	defer engine.Close()
+
+	ns1, err := engine.CreateNamespace()
+	require.NoError(t, err)
+
+	// pairs of accounts share an age, so that the pages split them
+	for i := 0; i < 7; i++ {
+		_, _, err := modusdb.Create(ctx, engine, Account{
+			ClerkId: fmt.Sprintf("%d", 100+i),
+			Age:     20 + i/2*10,
+		}, ns1.ID())
+		require.NoError(t, err)
+	}
+
+	params := modusdb.QueryParams{
+		Pagination: &modusdb.Pagination{Limit: 3},
+		Sorting:    &modusdb.Sorting{OrderDescField: "age"},
+	}
+	seen := make(map[string]bool)
+	lastAge := 100
+	var lastGid uint64
+	pages := 0
+	for {
+		page, err := modusdb.QueryPage[Account](ctx, engine, params, ns1.ID())
+		require.NoError(t, err)
+		require.Equal(t, int64(7), page.Total)
+		require.Len(t, page.Gids, len(page.Objs))
+		for i, account := range page.Objs {
+			require.False(t, seen[account.ClerkId])
+			require.LessOrEqual(t, account.Age, lastAge)
+			// the accounts sharing an age follow their gids
+			if account.Age == lastAge {
+				require.Greater(t, page.Gids[i], lastGid)
+			}
+			seen[account.ClerkId] = true
+			lastAge, lastGid = account.Age, page.Gids[i]
+		}
+		pages++
+		if !page.HasNext {
+			require.Empty(t, page.NextCursor)
+			break
+		}
+		require.Len(t, page.Objs, 3)
+		params.Pagination = &modusdb.Pagination{Limit: 3, Cursor: page.NextCursor}
+	}
+	require.Equal(t, 3, pages)
+	require.Len(t, seen, 7)
+
+	// without sorting, the pages follow the gids
+	page, err := modusdb.QueryPage[Account](ctx, engine, modusdb.QueryParams{
+		Pagination: &modusdb.Pagination{Limit: 4},
+	}, ns1.ID())
+	require.NoError(t, err)
+	require.True(t, page.HasNext)
+	next, err := modusdb.QueryPage[Account](ctx, engine, modusdb.QueryParams{
+		Pagination: &modusdb.Pagination{Limit: 4, Cursor: page.NextCursor},
+	}, ns1.ID())
+	require.NoError(t, err)
+	require.False(t, next.HasNext)
+	require.Len(t, next.Objs, 3)
+	require.Greater(t, next.Gids[0], page.Gids[3])
+
+	// the cursor is only valid for the sorting it was returned for
+	_, err = modusdb.QueryPage[Account](ctx, engine, modusdb.QueryParams{
+		Pagination: &modusdb.Pagination{Limit: 4, Cursor: page.NextCursor},
+		Sorting:    &modusdb.Sorting{OrderAscField: "age"},
+	}, ns1.ID())
+	require.ErrorIs(t, err, modusdb.ErrInvalidCursor)
+
+	_, err = modusdb.QueryPage[Account](ctx, engine, modusdb.QueryParams{
+		Pagination: &modusdb.Pagination{Limit: 4, Cursor: page.NextCursor + "x"},
+	}, ns1.ID())
+	require.ErrorIs(t, err, modusdb.ErrInvalidCursor)
+
+	// the values of the cursor must have the types of the sort fields
+	data, err := json.Marshal(map[string]any{
+		"s": "Account orderasc:" + apiutils.GetPredicateName("Account", "age"),
+		"v": []any{"old"},
+		"g": page.Gids[3],
+	})
+	require.NoError(t, err)
+	data = binary.BigEndian.AppendUint32(data, crc32.ChecksumIEEE(data))
+	_, err = modusdb.QueryPage[Account](ctx, engine, modusdb.QueryParams{
+		Pagination: &modusdb.Pagination{Limit: 4, Cursor: base64.RawURLEncoding.EncodeToString(data)},
+		Sorting:    &modusdb.Sorting{OrderAscField: "age"},
+	}, ns1.ID())
+	require.ErrorIs(t, err, modusdb.ErrInvalidCursor)
+
+	_, _, err = modusdb.Query[Account](ctx, engine, modusdb.QueryParams{
+		Pagination: &modusdb.Pagination{After: "0x1) { uid }"},
+	}, ns1.ID())
+	require.Error(t, err)
+}
+
+func TestQueryApiWithSortKeys(t *testing.T) {
+	ctx := context.Background()
+	engine, err := modusdb.NewEngine(modusdb.NewDefaultConfig(t.TempDir()))
+	require.NoError(t, err)
+	defer engine.Close()
+
+	ns1, err := engine.CreateNamespace()
+	require.NoError(t, err)
+
+	users := []User{
+		{Name: "A", Age: 30, ClerkId: "u1"},
+		{Name: "B", Age: 20, ClerkId: "u2"},
+		{Name: "C", Age: 30, ClerkId: "u3"},
+		{Name: "D", Age: 20, ClerkId: "u4"},
+	}
+	for _, user := range users {
+		_, _, err := modusdb.Create(ctx, engine, user, ns1.ID())
+		require.NoError(t, err)
+	}
+
+	_, queriedUsers, err := modusdb.Query[User](ctx, engine, modusdb.QueryParams{
+		Sorting: &modusdb.Sorting{Keys: []modusdb.SortKey{
+			{Field: "age"},
+			{Field: "name", Desc: true},
+		}},
+	}, ns1.ID())
+	require.NoError(t, err)
+	require.Len(t, queriedUsers, 4)
+	require.Equal(t, "D", queriedUsers[0].Name)
+	require.Equal(t, "B", queriedUsers[1].Name)
+	require.Equal(t, "C", queriedUsers[2].Name)
+	require.Equal(t, "A", queriedUsers[3].Name)
+
+	for i, name := range []string{"Zoe", "Adam", "Mia"} {
+		_, _, err := modusdb.Create(ctx, engine, Article{
+			Title:   fmt.Sprintf("Article %d", i),
+			ClerkId: fmt.Sprintf("a%d", i),
+			Writer:  Writer{Name: name, ClerkId: fmt.Sprintf("w%d", i)},
+		}, ns1.ID())
+		require.NoError(t, err)
+	}
+
+	// articles sorted by the names of their writers
+	_, articles, err := modusdb.Query[Article](ctx, engine, modusdb.QueryParams{
+		Sorting: &modusdb.Sorting{Keys: []modusdb.SortKey{{Field: "writer.name"}}},
+	}, ns1.ID())
+	require.NoError(t, err)
+	require.Len(t, articles, 3)
+	require.Equal(t, "Article 1", articles[0].Title)
+	require.Equal(t, "Article 2", articles[1].Title)
+	require.Equal(t, "Article 0", articles[2].Title)
+
+	documents := []Document{
+		{Text: "apple", TextVec: []float32{0.1, 0.1, 0.0}},
+		{Text: "gorilla", TextVec: []float32{1.0, 1.0, 1.0}},
+		{Text: "carrot", TextVec: []float32{0.0, 0.0, 1.0}},
+	}
+	for _, doc := range documents {
+		_, _, err := modusdb.Create(ctx, engine, doc, ns1.ID())
+		require.NoError(t, err)
+	}
+
+	_, docs, err := modusdb.Query[Document](ctx, engine, modusdb.QueryParams{
+		Sorting: &modusdb.Sorting{Keys: []modusdb.SortKey{
+			{Field: "textVec", SimilarTo: []float32{0.1, 0.1, 0.1}},
+		}},
+	}, ns1.ID())
+	require.NoError(t, err)
+	// by cosine distance, the metric of the vector index
+	require.Len(t, docs, 3)
+	require.Equal(t, "gorilla", docs[0].Text)
+	require.Equal(t, "apple", docs[1].Text)
+	require.Equal(t, "carrot", docs[2].Text)
+
+	// sort keys are checked before the query runs
+	for _, sorting := range []modusdb.Sorting{
+		{Keys: []modusdb.SortKey{{Field: "textVec"}}},
+		{Keys: []modusdb.SortKey{{Field: "text", SimilarTo: []float32{0.1, 0.1, 0.1}}}},
+		{Keys: []modusdb.SortKey{{Field: "text"}}, OrderAscField: "text"},
+		{Keys: []modusdb.SortKey{{Field: "missing"}}},
+	} {
+		_, _, err := modusdb.Query[Document](ctx, engine, modusdb.QueryParams{Sorting: &sorting}, ns1.ID())
+		require.Error(t, err)
+	}
+
+	_, _, err = modusdb.Query[Writer](ctx, engine, modusdb.QueryParams{
+		Edges: map[string]modusdb.QueryParams{
+			"posts": {Sorting: &modusdb.Sorting{Keys: []modusdb.SortKey{{Field: "writer.name"}}}},
+		},
+	}, ns1.ID())
+	require.Error(t, err)
+}
+
+type Passage struct {
+	Gid     uint64    `json:"gid,omitempty"`
+	Text    string    `json:"text,omitempty" db:"constraint=term"`
+	TextVec []float32 `json:"textVec,omitempty" db:"constraint=vector"`
+}
+
+type Review struct {
+	Gid     uint64    `json:"gid,omitempty"`
+	Text    string    `json:"text,omitempty" db:"constraint=fulltext"`
+	TextVec []float32 `json:"textVec,omitempty" db:"constraint=vector"`
+}
+
+func TestHybridSearchApi(t *testing.T) {
+	ctx := context.Background()
+	engine, err := modusdb.NewEngine(modusdb.NewDefaultConfig(t.TempDir()))
+	require.NoError(t, err)
+	defer engine.Close()
+
+	ns1, err := engine.CreateNamespace()
+	require.NoError(t, err)
+
+	passages := []Passage{
+		{Text: "red apple pie", TextVec: []float32{1.0, 0.1, 0.0}},
+		{Text: "green apple", TextVec: []float32{0.0, 1.0, 0.0}},
+		{Text: "cherry pie", TextVec: []float32{0.9, 0.2, 0.0}},
+		{Text: "blue sky", TextVec: []float32{0.0, 0.0, 1.0}},
+	}
+	for _, passage := range passages {
+		_, _, err := modusdb.Create(ctx, engine, passage, ns1.ID())
+		require.NoError(t, err)
+	}
+
+	params := modusdb.HybridSearchParams{
+		VectorField: "textVec",
+		SimilarTo:   []float32{1.0, 0.0, 0.0},
+		TextField:   "text",
+		Text:        "Apple pie",
+		TopK:        2,
+	}
+	results, err := modusdb.HybridSearch[Passage](ctx, engine, params, ns1.ID())
+	require.NoError(t, err)
+	require.Len(t, results, 2)
+	// first in both searches
+	require.Equal(t, "red apple pie", results[0].Obj.Text)
+	require.NotZero(t, results[0].Gid)
+	require.Greater(t, results[0].Score, results[1].Score)
+
+	params.Fusion = modusdb.FusionWeighted
+	params.VectorWeight, params.TextWeight = 1, 0
+	results, err = modusdb.HybridSearch[Passage](ctx, engine, params, ns1.ID())
+	require.NoError(t, err)
+	require.Len(t, results, 2)
+	require.Equal(t, "red apple pie", results[0].Obj.Text)
+	require.Equal(t, "cherry pie", results[1].Obj.Text)
+
+	params.VectorWeight, params.TextWeight = 0, 1
+	params.Filter = &modusdb.Filter{Field: "text", String: modusdb.StringPredicate{AnyOfTerms: []string{"green"}}}
+	results, err = modusdb.HybridSearch[Passage](ctx, engine, params, ns1.ID())
+	require.NoError(t, err)
+	require.Len(t, results, 1)
+	require.Equal(t, "green apple", results[0].Obj.Text)
+	require.InDelta(t, 0.5, results[0].Score, 1e-9)
+
+	// the text field of documents has no index to search
+	_, err = modusdb.HybridSearch[Document](ctx, engine, modusdb.HybridSearchParams{
+		VectorField: "textVec",
+		SimilarTo:   []float32{1.0, 0.0, 0.0},
+		TextField:   "text",
+		Text:        "apple",
+		TopK:        2,
+	}, ns1.ID())
+	require.Error(t, err)
+
+	// fulltext indexes match the stems of the words, leaving out the stop words
+	reviews := []Review{
+		{Text: "the apples were baked in pies", TextVec: []float32{0.0, 1.0, 0.0}},
+		{Text: "an apple a day", TextVec: []float32{0.0, 0.0, 1.0}},
+	}
+	for _, review := range reviews {
+		_, _, err := modusdb.Create(ctx, engine, review, ns1.ID())
+		require.NoError(t, err)
+	}
+	found, err := modusdb.HybridSearch[Review](ctx, engine, modusdb.HybridSearchParams{
+		VectorField:  "textVec",
+		SimilarTo:    []float32{1.0, 0.0, 0.0},
+		TextField:    "text",
+		Text:         "The apple pie, apples",
+		TopK:         2,
+		Fusion:       modusdb.FusionWeighted,
+		VectorWeight: 0,
+		TextWeight:   1,
+	}, ns1.ID())
+	require.NoError(t, err)
+	require.Len(t, found, 2)
+	require.Equal(t, "the apples were baked in pies", found[0].Obj.Text)
+	require.InDelta(t, 1.0, found[0].Score, 1e-9)
+	require.Equal(t, "an apple a day", found[1].Obj.Text)
+	require.InDelta(t, 0.5, found[1].Score, 1e-9)
+}
+
+type Landmark struct {
+	Gid      uint64    `json:"gid,omitempty"`
+	Name     string    `json:"name,omitempty"`
+	Position []float32 `json:"position,omitempty" db:"constraint=vector,metric=euclidean"`
+}
+
+type BadLandmark struct {
+	Gid      uint64    `json:"gid,omitempty"`
+	Position []float32 `json:"position,omitempty" db:"constraint=vector,metric=manhattan"`
+}
+
+func TestVectorSearchApi(t *testing.T) {
+	ctx := context.Background()
+	engine, err := modusdb.NewEngine(modusdb.NewDefaultConfig(t.TempDir()))
+	require.NoError(t, err)
+	defer engine.Close()
+
+	ns1, err := engine.CreateNamespace()
+	require.NoError(t, err)
+
+	passages := []Passage{
+		{Text: "red apple pie", TextVec: []float32{1.0, 0.1, 0.0}},
+		{Text: "cherry pie", TextVec: []float32{0.9, 0.2, 0.0}},
+		{Text: "blue sky", TextVec: []float32{0.0, 0.0, 1.0}},
+	}
+	for _, passage := range passages {
+		_, _, err := modusdb.Create(ctx, engine, passage, ns1.ID())
+		require.NoError(t, err)
+	}
+
+	// cosine is the default metric
+	results, err := modusdb.VectorSearch[Passage](ctx, engine, modusdb.VectorSearchParams{
+		Field:     "textVec",
+		SimilarTo: []float32{1.0, 0.0, 0.0},
+		TopK:      2,
+	}, ns1.ID())
+	require.NoError(t, err)
+	require.Len(t, results, 2)
+	require.Equal(t, "red apple pie", results[0].Obj.Text)
+	require.InDelta(t, 1-1/math.Sqrt(1.01), results[0].Distance, 1e-4)
+	require.Equal(t, "cherry pie", results[1].Obj.Text)
+	require.InDelta(t, 1-0.9/math.Sqrt(0.85), results[1].Distance, 1e-4)
+	require.Greater(t, results[0].Score, results[1].Score)
+
+	landmarks := []Landmark{
+		{Name: "near", Position: []float32{1, 0, 0}},
+		{Name: "middle", Position: []float32{0, 2, 0}},
+		{Name: "far", Position: []float32{3, 4, 0}},
+	}
+	for _, landmark := range landmarks {
+		_, _, err := modusdb.Create(ctx, engine, landmark, ns1.ID())
+		require.NoError(t, err)
+	}
+
+	maxDistance := 2.5
+	found, err := modusdb.VectorSearch[Landmark](ctx, engine, modusdb.VectorSearchParams{
+		Field:       "position",
+		SimilarTo:   []float32{0, 0, 0},
+		TopK:        3,
+		MaxDistance: &maxDistance,
+	}, ns1.ID())
+	require.NoError(t, err)
+	require.Len(t, found, 2)
+	require.Equal(t, "near", found[0].Obj.Name)
+	require.InDelta(t, 1.0, found[0].Distance, 1e-6)
+	require.Equal(t, "middle", found[1].Obj.Name)
+	require.InDelta(t, 2.0, found[1].Distance, 1e-6)
+
+	_, _, err = modusdb.Create(ctx, engine, BadLandmark{Position: []float32{1, 0, 0}}, ns1.ID())
+	require.Error(t, err)
+
+	_, err = modusdb.VectorSearch[Landmark](ctx, engine, modusdb.VectorSearchParams{
+		Field:     "name",
+		SimilarTo: []float32{0, 0, 0},
+		TopK:      3,
+	}, ns1.ID())
+	require.Error(t, err)
+}
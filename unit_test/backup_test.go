@@ -0,0 +1,166 @@
+/*
+ * SPDX-FileCopyrightText: © Hypermode Inc. <hello@hypermode.com>
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package unit_test
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"testing"
+
+	"github.com/stretchr/testify/require"
+
+	"github.com/hypermodeinc/modusdb"
+)
+
+func TestBackupRestore(t *testing.T) {
+	ctx := context.Background()
+	engine, err := modusdb.NewEngine(modusdb.NewDefaultConfig(t.TempDir()))
+	require.NoError(t, err)
+
+	ns1, err := engine.CreateNamespace(modusdb.WithNamespaceName("tenant"))
+	require.NoError(t, err)
+
+	_, _, err = modusdb.Create(ctx, engine, User{Name: "A", Age: 10, ClerkId: "123"}, ns1.ID())
+	require.NoError(t, err)
+
+	var full bytes.Buffer
+	backupTs, err := engine.Backup(ctx, &full, 0)
+	require.NoError(t, err)
+	require.NotZero(t, backupTs)
+
+	_, _, err = modusdb.Create(ctx, engine, User{Name: "B", Age: 20, ClerkId: "456"}, ns1.ID())
+	require.NoError(t, err)
+
+	var incremental bytes.Buffer
+	incrementalTs, err := engine.Backup(ctx, &incremental, backupTs)
+	require.NoError(t, err)
+	require.Greater(t, incrementalTs, backupTs)
+	require.Less(t, incremental.Len(), full.Len())
+	engine.Close()
+
+	engine, err = modusdb.NewEngine(modusdb.NewDefaultConfig(t.TempDir()))
+	require.NoError(t, err)
+	defer engine.Close()
+
+	require.NoError(t, engine.Restore(ctx, &full))
+	ns1, err = engine.GetNamespaceByName("tenant")
+	require.NoError(t, err)
+
+	_, users, err := modusdb.Query[User](ctx, engine, modusdb.QueryParams{}, ns1.ID())
+	require.NoError(t, err)
+	require.Len(t, users, 1)
+	require.Equal(t, "A", users[0].Name)
+
+	require.NoError(t, engine.Restore(ctx, &incremental))
+	_, users, err = modusdb.Query[User](ctx, engine, modusdb.QueryParams{}, ns1.ID())
+	require.NoError(t, err)
+	require.Len(t, users, 2)
+
+	// new writes do not reuse restored UIDs
+	_, _, err = modusdb.Create(ctx, engine, User{Name: "C", Age: 30, ClerkId: "789"}, ns1.ID())
+	require.NoError(t, err)
+	_, users, err = modusdb.Query[User](ctx, engine, modusdb.QueryParams{}, ns1.ID())
+	require.NoError(t, err)
+	require.Len(t, users, 3)
+
+	require.ErrorIs(t, engine.Restore(ctx, bytes.NewReader([]byte("garbage"))), modusdb.ErrInvalidBackup)
+
+	// transactions opened before a restore would outlive the data they read
+	txn, err := ns1.NewReadOnlyTxn()
+	require.NoError(t, err)
+	require.ErrorIs(t, engine.Restore(ctx, bytes.NewReader(full.Bytes())), modusdb.ErrOpenTxns)
+	require.NoError(t, txn.Discard(ctx))
+}
+
+func TestBackupRestoreNamespace(t *testing.T) {
+	ctx := context.Background()
+	engine, err := modusdb.NewEngine(modusdb.NewDefaultConfig(t.TempDir()))
+	require.NoError(t, err)
+	defer engine.Close()
+
+	ns1, err := engine.CreateNamespace()
+	require.NoError(t, err)
+	ns2, err := engine.CreateNamespace()
+	require.NoError(t, err)
+
+	_, _, err = modusdb.Create(ctx, engine, User{Name: "A", Age: 10, ClerkId: "123"}, ns1.ID())
+	require.NoError(t, err)
+	_, _, err = modusdb.Create(ctx, engine, User{Name: "B", Age: 20, ClerkId: "456"}, ns2.ID())
+	require.NoError(t, err)
+
+	var buf bytes.Buffer
+	_, err = engine.Backup(ctx, &buf, 0, ns1.ID())
+	require.NoError(t, err)
+
+	require.NoError(t, ns1.DropData(ctx))
+	_, _, err = modusdb.Create(ctx, engine, User{Name: "C", Age: 30, ClerkId: "789"}, ns2.ID())
+	require.NoError(t, err)
+
+	require.NoError(t, engine.Restore(ctx, bytes.NewReader(buf.Bytes())))
+
+	_, users, err := modusdb.Query[User](ctx, engine, modusdb.QueryParams{}, ns1.ID())
+	require.NoError(t, err)
+	require.Len(t, users, 1)
+	require.Equal(t, "A", users[0].Name)
+
+	// the other namespaces are left untouched
+	_, users, err = modusdb.Query[User](ctx, engine, modusdb.QueryParams{}, ns2.ID())
+	require.NoError(t, err)
+	require.Len(t, users, 2)
+
+	// restoring a single namespace only leases its own ID
+	engine.Close()
+	engine, err = modusdb.NewEngine(modusdb.NewDefaultConfig(t.TempDir()))
+	require.NoError(t, err)
+	defer engine.Close()
+	require.NoError(t, engine.Restore(ctx, bytes.NewReader(buf.Bytes())))
+	_, err = engine.GetNamespace(ns1.ID())
+	require.NoError(t, err)
+	ns, err := engine.CreateNamespace()
+	require.NoError(t, err)
+	require.Equal(t, ns1.ID()+1, ns.ID())
+}
+
+func TestIncrementalBackupAfterDrop(t *testing.T) {
+	ctx := context.Background()
+	engine, err := modusdb.NewEngine(modusdb.NewDefaultConfig(t.TempDir()))
+	require.NoError(t, err)
+	defer engine.Close()
+
+	ns1, err := engine.CreateNamespace()
+	require.NoError(t, err)
+	ns2, err := engine.CreateNamespace()
+	require.NoError(t, err)
+
+	_, _, err = modusdb.Create(ctx, engine, User{Name: "A", Age: 10, ClerkId: "123"}, ns1.ID())
+	require.NoError(t, err)
+	_, _, err = modusdb.Create(ctx, engine, User{Name: "B", Age: 20, ClerkId: "456"}, ns2.ID())
+	require.NoError(t, err)
+
+	var full bytes.Buffer
+	backupTs, err := engine.Backup(ctx, &full, 0)
+	require.NoError(t, err)
+
+	// the incremental backups cannot record the drop
+	require.NoError(t, ns1.DropPredicate(ctx, "User.age"))
+	_, err = engine.Backup(ctx, io.Discard, backupTs)
+	require.ErrorIs(t, err, modusdb.ErrDroppedSinceBackup)
+	_, err = engine.Backup(ctx, io.Discard, backupTs, ns1.ID())
+	require.ErrorIs(t, err, modusdb.ErrDroppedSinceBackup)
+
+	// the other namespaces and the backups taken after the drop are not affected
+	_, err = engine.Backup(ctx, io.Discard, backupTs, ns2.ID())
+	require.NoError(t, err)
+	backupTs, err = engine.Backup(ctx, io.Discard, 0)
+	require.NoError(t, err)
+	_, err = engine.Backup(ctx, io.Discard, backupTs)
+	require.NoError(t, err)
+
+	require.NoError(t, engine.DropAll(ctx))
+	_, err = engine.Backup(ctx, io.Discard, backupTs, ns2.ID())
+	require.ErrorIs(t, err, modusdb.ErrDroppedSinceBackup)
+}
@@ -7,6 +7,7 @@ package unit_test
 
 import (
 	"context"
+	"fmt"
 	"testing"
 
 	"github.com/dgraph-io/dgo/v240/protos/api"
@@ -291,3 +292,310 @@ func TestDBDBRestart(t *testing.T) {
 	require.NoError(t, err)
 	require.JSONEq(t, `{"me":[{"bar":"B"}]}`, string(resp.GetJson()))
 }
+
+func TestDeleteNamespace(t *testing.T) {
+	dataDir := t.TempDir()
+	engine, err := modusdb.NewEngine(modusdb.NewDefaultConfig(dataDir))
+	require.NoError(t, err)
+	defer func() { engine.Close() }()
+
+	ns1, err := engine.CreateNamespace()
+	require.NoError(t, err)
+	ns2, err := engine.CreateNamespace()
+	require.NoError(t, err)
+
+	for _, ns := range []*modusdb.Namespace{ns1, ns2} {
+		require.NoError(t, ns.AlterSchema(context.Background(), "name: string @index(exact) ."))
+		_, err = ns.Mutate(context.Background(), []*api.Mutation{
+			{
+				Set: []*api.NQuad{
+					{
+						Subject:     "_:aman",
+						Predicate:   "name",
+						ObjectValue: &api.Value{Val: &api.Value_StrVal{StrVal: "A"}},
+					},
+				},
+			},
+		})
+		require.NoError(t, err)
+	}
+
+	require.ErrorIs(t, engine.DeleteNamespace(context.Background(), 0), modusdb.ErrDeleteDefaultNamespace)
+	require.NoError(t, engine.DeleteNamespace(context.Background(), ns1.ID()))
+	require.ErrorIs(t, engine.DeleteNamespace(context.Background(), ns1.ID()), modusdb.ErrNonExistentDB)
+
+	_, err = engine.GetNamespace(ns1.ID())
+	require.ErrorIs(t, err, modusdb.ErrNonExistentDB)
+	_, err = ns1.Query(context.Background(), `{ me(func: has(name)) { name } }`)
+	require.ErrorIs(t, err, modusdb.ErrNonExistentDB)
+
+	namespaces, err := engine.ListNamespaces()
+	require.NoError(t, err)
+	require.Len(t, namespaces, 2)
+	require.Equal(t, uint64(0), namespaces[0].ID())
+	require.Equal(t, ns2.ID(), namespaces[1].ID())
+
+	// the other namespaces are not affected
+	query := `{
+		me(func: has(name)) {
+			name
+		}
+	}`
+	resp, err := ns2.Query(context.Background(), query)
+	require.NoError(t, err)
+	require.JSONEq(t, `{"me":[{"name":"A"}]}`, string(resp.GetJson()))
+
+	// the deletion survives a restart
+	engine.Close()
+	engine, err = modusdb.NewEngine(modusdb.NewDefaultConfig(dataDir))
+	require.NoError(t, err)
+
+	_, err = engine.GetNamespace(ns1.ID())
+	require.ErrorIs(t, err, modusdb.ErrNonExistentDB)
+	namespaces, err = engine.ListNamespaces()
+	require.NoError(t, err)
+	require.Len(t, namespaces, 2)
+
+	ns3, err := engine.CreateNamespace()
+	require.NoError(t, err)
+	require.Greater(t, ns3.ID(), ns2.ID())
+}
+
+func TestNamedNamespaces(t *testing.T) {
+	dataDir := t.TempDir()
+	engine, err := modusdb.NewEngine(modusdb.NewDefaultConfig(dataDir))
+	require.NoError(t, err)
+	defer func() { engine.Close() }()
+
+	ns1, err := engine.CreateNamespace(
+		modusdb.WithNamespaceName("tenant-a"),
+		modusdb.WithNamespaceLabels(map[string]string{"plan": "free"}),
+	)
+	require.NoError(t, err)
+	require.Equal(t, "tenant-a", ns1.Name())
+	require.Equal(t, map[string]string{"plan": "free"}, ns1.Labels())
+
+	_, err = engine.CreateNamespace(modusdb.WithNamespaceName("tenant-a"))
+	require.ErrorIs(t, err, modusdb.ErrNamespaceNameExists)
+
+	ns2, err := engine.CreateNamespace(modusdb.WithNamespaceName("tenant-b"))
+	require.NoError(t, err)
+
+	ns, err := engine.GetNamespaceByName("tenant-a")
+	require.NoError(t, err)
+	require.Equal(t, ns1.ID(), ns.ID())
+	_, err = engine.GetNamespaceByName("tenant-c")
+	require.ErrorIs(t, err, modusdb.ErrNonExistentDB)
+
+	require.ErrorIs(t, ns1.Rename("tenant-b"), modusdb.ErrNamespaceNameExists)
+	require.ErrorIs(t, ns1.Rename(""), modusdb.ErrEmptyNamespaceName)
+	require.NoError(t, ns1.Rename("tenant-c"))
+	_, err = engine.GetNamespaceByName("tenant-a")
+	require.ErrorIs(t, err, modusdb.ErrNonExistentDB)
+
+	// the name of a deleted namespace can be reused
+	require.NoError(t, engine.DeleteNamespace(context.Background(), ns2.ID()))
+	ns3, err := engine.CreateNamespace(modusdb.WithNamespaceName("tenant-b"))
+	require.NoError(t, err)
+
+	// names and labels survive a restart
+	engine.Close()
+	engine, err = modusdb.NewEngine(modusdb.NewDefaultConfig(dataDir))
+	require.NoError(t, err)
+
+	ns, err = engine.GetNamespaceByName("tenant-c")
+	require.NoError(t, err)
+	require.Equal(t, ns1.ID(), ns.ID())
+	require.Equal(t, map[string]string{"plan": "free"}, ns.Labels())
+
+	ns, err = engine.GetNamespaceByName("tenant-b")
+	require.NoError(t, err)
+	require.Equal(t, ns3.ID(), ns.ID())
+}
+
+func TestMutateDelete(t *testing.T) {
+	ctx := context.Background()
+	engine, err := modusdb.NewEngine(modusdb.NewDefaultConfig(t.TempDir()))
+	require.NoError(t, err)
+	defer engine.Close()
+
+	ns1, err := engine.CreateNamespace()
+	require.NoError(t, err)
+	require.NoError(t, ns1.AlterSchema(ctx, `
+		name: string @index(exact) .
+		nick: [string] .
+		age: int .
+		type Person {
+			name
+			nick
+			age
+		}
+	`))
+
+	uids, err := ns1.Mutate(ctx, []*api.Mutation{{
+		SetNquads: []byte(`
+			_:a <dgraph.type> "Person" .
+			_:a <name> "A" .
+			_:a <nick> "x" .
+			_:a <nick> "y" .
+			_:a <age> "10" .
+			_:b <dgraph.type> "Person" .
+			_:b <name> "B" .
+			_:b <age> "20" .
+		`),
+	}})
+	require.NoError(t, err)
+	a, b := uids["_:a"], uids["_:b"]
+
+	const query = `{
+		q(func: type(Person), orderasc: name) {
+			name
+			nick
+			age
+		}
+	}`
+
+	// a single value with Del
+	_, err = ns1.Mutate(ctx, []*api.Mutation{{
+		Del: []*api.NQuad{{
+			Subject:     fmt.Sprintf("%#x", a),
+			Predicate:   "nick",
+			ObjectValue: &api.Value{Val: &api.Value_StrVal{StrVal: "x"}},
+		}},
+	}})
+	require.NoError(t, err)
+	resp, err := ns1.Query(ctx, query)
+	require.NoError(t, err)
+	require.JSONEq(t, `{"q":[{"name":"A","nick":["y"],"age":10},{"name":"B","age":20}]}`, string(resp.Json))
+
+	// all the values of a predicate with DelNquads
+	_, err = ns1.Mutate(ctx, []*api.Mutation{{
+		DelNquads: []byte(fmt.Sprintf("<%#x> <age> * .", a)),
+	}})
+	require.NoError(t, err)
+	resp, err = ns1.Query(ctx, query)
+	require.NoError(t, err)
+	require.JSONEq(t, `{"q":[{"name":"A","nick":["y"]},{"name":"B","age":20}]}`, string(resp.Json))
+
+	// all the predicates of the node, the index is updated as well
+	_, err = ns1.Mutate(ctx, []*api.Mutation{{
+		DeleteJson: []byte(fmt.Sprintf(`{"uid": "%#x"}`, b)),
+	}})
+	require.NoError(t, err)
+	resp, err = ns1.Query(ctx, query)
+	require.NoError(t, err)
+	require.JSONEq(t, `{"q":[{"name":"A","nick":["y"]}]}`, string(resp.Json))
+	resp, err = ns1.Query(ctx, `{ q(func: eq(name, "B")) { uid } }`)
+	require.NoError(t, err)
+	require.JSONEq(t, `{"q":[]}`, string(resp.Json))
+}
+
+func TestDropPredicateAndType(t *testing.T) {
+	ctx := context.Background()
+	engine, err := modusdb.NewEngine(modusdb.NewDefaultConfig(t.TempDir()))
+	require.NoError(t, err)
+	defer engine.Close()
+
+	ns1, err := engine.CreateNamespace()
+	require.NoError(t, err)
+	ns2, err := engine.CreateNamespace()
+	require.NoError(t, err)
+
+	const sch = `
+		name: string @index(exact) .
+		age: int .
+		type Person {
+			name
+			age
+		}
+	`
+	for _, ns := range []*modusdb.Namespace{ns1, ns2} {
+		require.NoError(t, ns.AlterSchema(ctx, sch))
+		_, err = ns.Mutate(ctx, []*api.Mutation{{
+			SetNquads: []byte(`
+				_:a <dgraph.type> "Person" .
+				_:a <name> "A" .
+				_:a <age> "10" .
+			`),
+		}})
+		require.NoError(t, err)
+	}
+
+	require.NoError(t, ns1.DropPredicate(ctx, "age"))
+	resp, err := ns1.Query(ctx, `{ q(func: eq(name, "A")) { name age } }`)
+	require.NoError(t, err)
+	require.JSONEq(t, `{"q":[{"name":"A"}]}`, string(resp.Json))
+	resp, err = ns1.Query(ctx, `schema(pred: [age]) { type }`)
+	require.NoError(t, err)
+	require.NotContains(t, string(resp.Json), `"predicate":"age"`)
+
+	require.NoError(t, ns1.DropType(ctx, "Person"))
+	resp, err = ns1.Query(ctx, `schema(type: Person) {}`)
+	require.NoError(t, err)
+	require.NotContains(t, string(resp.Json), `"name":"Person"`)
+	// the data of the predicates of the type is kept
+	resp, err = ns1.Query(ctx, `{ q(func: eq(name, "A")) { name } }`)
+	require.NoError(t, err)
+	require.JSONEq(t, `{"q":[{"name":"A"}]}`, string(resp.Json))
+
+	// the other namespaces are not affected
+	resp, err = ns2.Query(ctx, `{ q(func: type(Person)) { name age } }`)
+	require.NoError(t, err)
+	require.JSONEq(t, `{"q":[{"name":"A","age":10}]}`, string(resp.Json))
+
+	require.Error(t, ns1.DropPredicate(ctx, "dgraph.type"))
+	require.Error(t, ns1.DropType(ctx, "dgraph.graphql"))
+}
+
+func TestMutateQueryResult(t *testing.T) {
+	ctx := context.Background()
+	engine, err := modusdb.NewEngine(modusdb.NewDefaultConfig(t.TempDir()))
+	require.NoError(t, err)
+	defer engine.Close()
+
+	ns1, err := engine.CreateNamespace()
+	require.NoError(t, err)
+	require.NoError(t, ns1.AlterSchema(ctx, "name: string @index(exact) ."))
+
+	res, err := ns1.MutateWithResult(ctx, []*api.Mutation{{
+		SetNquads: []byte(`_:a <name> "A" .`),
+	}})
+	require.NoError(t, err)
+	require.NotZero(t, res.Uids["_:a"])
+	require.Greater(t, res.CommitTs, res.StartTs)
+	require.Positive(t, res.Latency.Total)
+	require.Zero(t, res.Latency.Encoding)
+
+	// the write is visible to the queries reading at its commit timestamp or later
+	qres, err := ns1.QueryWithResult(ctx, `{ q(func: eq(name, "A")) { name } }`)
+	require.NoError(t, err)
+	require.JSONEq(t, `{"q":[{"name":"A"}]}`, string(qres.Json))
+	require.GreaterOrEqual(t, qres.ReadTs, res.CommitTs)
+	require.Positive(t, qres.Latency.Total)
+
+	txn, err := ns1.NewReadOnlyTxn(modusdb.AtTimestamp(qres.ReadTs))
+	require.NoError(t, err)
+	tres, err := txn.QueryWithResult(ctx, `{ q(func: eq(name, "A")) { name } }`)
+	require.NoError(t, err)
+	require.Equal(t, qres.ReadTs, tres.ReadTs)
+	require.NoError(t, txn.Discard(ctx))
+
+	// the commit timestamp of the mutations of a transaction is known once committed
+	txn, err = ns1.NewTxn()
+	require.NoError(t, err)
+	res, err = txn.MutateWithResult(ctx, []*api.Mutation{{
+		SetNquads: []byte(`_:b <name> "B" .`),
+	}})
+	require.NoError(t, err)
+	require.NotZero(t, res.Uids["_:b"])
+	require.Equal(t, txn.StartTs(), res.StartTs)
+	require.Zero(t, res.CommitTs)
+	require.NoError(t, txn.Commit(ctx))
+	require.Greater(t, txn.CommitTs(), txn.StartTs())
+
+	ures, mres, err := ns1.UpsertWithResult(ctx, `{ q(func: eq(name, "B")) { v as uid } }`,
+		[]*api.Mutation{{SetNquads: []byte(`uid(v) <name> "C" .`)}})
+	require.NoError(t, err)
+	require.Equal(t, mres.StartTs, ures.ReadTs)
+	require.Greater(t, mres.CommitTs, mres.StartTs)
+}
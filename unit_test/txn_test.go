@@ -0,0 +1,311 @@
+/*
+ * SPDX-FileCopyrightText: © Hypermode Inc. <hello@hypermode.com>
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package unit_test
+
+import (
+	"context"
+	"fmt"
+	"testing"
+
+	"github.com/dgraph-io/dgo/v240/protos/api"
+	"github.com/stretchr/testify/require"
+	"golang.org/x/sync/errgroup"
+
+	"github.com/hypermodeinc/modusdb"
+)
+
+func TestTxnCommit(t *testing.T) {
+	ctx := context.Background()
+	engine, err := modusdb.NewEngine(modusdb.NewDefaultConfig(t.TempDir()))
+	require.NoError(t, err)
+	defer engine.Close()
+
+	ns1, err := engine.CreateNamespace()
+	require.NoError(t, err)
+	require.NoError(t, ns1.AlterSchema(ctx, "name: string @index(exact) ."))
+
+	txn, err := ns1.NewTxn()
+	require.NoError(t, err)
+
+	uids, err := txn.Mutate(ctx, []*api.Mutation{{
+		Set: []*api.NQuad{{
+			Subject:     "_:aman",
+			Predicate:   "name",
+			ObjectValue: &api.Value{Val: &api.Value_StrVal{StrVal: "A"}},
+		}},
+	}})
+	require.NoError(t, err)
+	require.NotZero(t, uids["_:aman"])
+
+	_, err = txn.Mutate(ctx, []*api.Mutation{{
+		Set: []*api.NQuad{{
+			Subject:     "_:bman",
+			Predicate:   "name",
+			ObjectValue: &api.Value{Val: &api.Value_StrVal{StrVal: "B"}},
+		}},
+	}})
+	require.NoError(t, err)
+
+	query := `{
+		me(func: has(name), orderasc: name) {
+			name
+		}
+	}`
+
+	// the transaction reads its own writes
+	resp, err := txn.Query(ctx, query)
+	require.NoError(t, err)
+	require.JSONEq(t, `{"me":[{"name":"A"},{"name":"B"}]}`, string(resp.GetJson()))
+
+	// nothing is visible outside the transaction before commit
+	resp, err = ns1.Query(ctx, query)
+	require.NoError(t, err)
+	require.JSONEq(t, `{"me":[]}`, string(resp.GetJson()))
+
+	require.NoError(t, txn.Commit(ctx))
+	require.ErrorIs(t, txn.Commit(ctx), modusdb.ErrTxnFinished)
+
+	resp, err = ns1.Query(ctx, query)
+	require.NoError(t, err)
+	require.JSONEq(t, `{"me":[{"name":"A"},{"name":"B"}]}`, string(resp.GetJson()))
+}
+
+func TestTxnDiscard(t *testing.T) {
+	ctx := context.Background()
+	engine, err := modusdb.NewEngine(modusdb.NewDefaultConfig(t.TempDir()))
+	require.NoError(t, err)
+	defer engine.Close()
+
+	ns1, err := engine.CreateNamespace()
+	require.NoError(t, err)
+	require.NoError(t, ns1.AlterSchema(ctx, "name: string @index(exact) ."))
+
+	txn, err := ns1.NewTxn()
+	require.NoError(t, err)
+
+	_, err = txn.Mutate(ctx, []*api.Mutation{{
+		Set: []*api.NQuad{{
+			Subject:     "_:aman",
+			Predicate:   "name",
+			ObjectValue: &api.Value{Val: &api.Value_StrVal{StrVal: "A"}},
+		}},
+	}})
+	require.NoError(t, err)
+	require.NoError(t, txn.Discard(ctx))
+
+	_, err = txn.Query(ctx, `{ me(func: has(name)) { name } }`)
+	require.ErrorIs(t, err, modusdb.ErrTxnFinished)
+
+	resp, err := ns1.Query(ctx, `{ me(func: has(name)) { name } }`)
+	require.NoError(t, err)
+	require.JSONEq(t, `{"me":[]}`, string(resp.GetJson()))
+}
+
+func TestTxnConflict(t *testing.T) {
+	ctx := context.Background()
+	engine, err := modusdb.NewEngine(modusdb.NewDefaultConfig(t.TempDir()))
+	require.NoError(t, err)
+	defer engine.Close()
+
+	ns1, err := engine.CreateNamespace()
+	require.NoError(t, err)
+	require.NoError(t, ns1.AlterSchema(ctx, "name: string @index(exact) ."))
+
+	uids, err := ns1.Mutate(ctx, []*api.Mutation{{
+		Set: []*api.NQuad{{
+			Subject:     "_:aman",
+			Predicate:   "name",
+			ObjectValue: &api.Value{Val: &api.Value_StrVal{StrVal: "A"}},
+		}},
+	}})
+	require.NoError(t, err)
+	uid := uids["_:aman"]
+
+	setName := func(txn *modusdb.Txn, name string) {
+		_, err := txn.Mutate(ctx, []*api.Mutation{{
+			Set: []*api.NQuad{{
+				Subject:     fmt.Sprintf("%#x", uid),
+				Predicate:   "name",
+				ObjectValue: &api.Value{Val: &api.Value_StrVal{StrVal: name}},
+			}},
+		}})
+		require.NoError(t, err)
+	}
+
+	txn1, err := ns1.NewTxn()
+	require.NoError(t, err)
+	txn2, err := ns1.NewTxn()
+	require.NoError(t, err)
+
+	setName(txn1, "B")
+	setName(txn2, "C")
+
+	require.NoError(t, txn1.Commit(ctx))
+	require.ErrorIs(t, txn2.Commit(ctx), modusdb.ErrTxnAborted)
+
+	resp, err := ns1.Query(ctx, `{ me(func: has(name), orderasc: name) { name } }`)
+	require.NoError(t, err)
+	require.JSONEq(t, `{"me":[{"name":"B"}]}`, string(resp.GetJson()))
+}
+
+func TestTxnTypedApi(t *testing.T) {
+	ctx := context.Background()
+	engine, err := modusdb.NewEngine(modusdb.NewDefaultConfig(t.TempDir()))
+	require.NoError(t, err)
+	defer engine.Close()
+
+	ns1, err := engine.CreateNamespace()
+	require.NoError(t, err)
+
+	txn, err := ns1.NewTxn()
+	require.NoError(t, err)
+	txnCtx := modusdb.ContextWithTxn(ctx, txn)
+
+	gid1, _, err := modusdb.Create(txnCtx, engine, User{Name: "A", Age: 10, ClerkId: "123"})
+	require.NoError(t, err)
+	_, _, err = modusdb.Create(txnCtx, engine, User{Name: "B", Age: 20, ClerkId: "456"})
+	require.NoError(t, err)
+
+	_, user, err := modusdb.Get[User](txnCtx, engine, gid1)
+	require.NoError(t, err)
+	require.Equal(t, "A", user.Name)
+
+	_, _, err = modusdb.Get[User](ctx, engine, gid1, ns1.ID())
+	require.ErrorContains(t, err, "no object found")
+
+	_, _, err = modusdb.Get[User](txnCtx, engine, gid1, ns1.ID()+1)
+	require.Error(t, err)
+
+	require.NoError(t, txn.Commit(ctx))
+
+	_, users, err := modusdb.Query[User](ctx, engine, modusdb.QueryParams{}, ns1.ID())
+	require.NoError(t, err)
+	require.Len(t, users, 2)
+
+	txn, err = ns1.NewTxn()
+	require.NoError(t, err)
+	txnCtx = modusdb.ContextWithTxn(ctx, txn)
+
+	_, _, err = modusdb.Delete[User](txnCtx, engine, gid1)
+	require.NoError(t, err)
+	require.NoError(t, txn.Discard(ctx))
+
+	_, user, err = modusdb.Get[User](ctx, engine, gid1, ns1.ID())
+	require.NoError(t, err)
+	require.Equal(t, "A", user.Name)
+}
+
+func TestReadOnlyTxn(t *testing.T) {
+	ctx := context.Background()
+	engine, err := modusdb.NewEngine(modusdb.NewDefaultConfig(t.TempDir()))
+	require.NoError(t, err)
+	defer engine.Close()
+
+	ns1, err := engine.CreateNamespace()
+	require.NoError(t, err)
+
+	_, _, err = modusdb.Create(ctx, engine, User{Name: "A", Age: 10, ClerkId: "123"}, ns1.ID())
+	require.NoError(t, err)
+
+	txn, err := ns1.NewReadOnlyTxn()
+	require.NoError(t, err)
+	require.True(t, txn.ReadOnly())
+	txnCtx := modusdb.ContextWithTxn(ctx, txn)
+
+	_, _, err = modusdb.Create(ctx, engine, User{Name: "B", Age: 20, ClerkId: "456"}, ns1.ID())
+	require.NoError(t, err)
+
+	// the read-only transaction keeps reading the snapshot it started with
+	_, users, err := modusdb.Query[User](txnCtx, engine, modusdb.QueryParams{})
+	require.NoError(t, err)
+	require.Len(t, users, 1)
+	require.Equal(t, "A", users[0].Name)
+
+	_, users, err = modusdb.Query[User](ctx, engine, modusdb.QueryParams{}, ns1.ID())
+	require.NoError(t, err)
+	require.Len(t, users, 2)
+
+	_, err = txn.Mutate(ctx, []*api.Mutation{{
+		Set: []*api.NQuad{{
+			Subject:     "_:aman",
+			Predicate:   "name",
+			ObjectValue: &api.Value{Val: &api.Value_StrVal{StrVal: "A"}},
+		}},
+	}})
+	require.ErrorIs(t, err, modusdb.ErrReadOnlyTxn)
+	_, _, err = modusdb.Create(txnCtx, engine, User{Name: "C", Age: 30, ClerkId: "789"})
+	require.ErrorIs(t, err, modusdb.ErrReadOnlyTxn)
+	require.ErrorIs(t, txn.Commit(ctx), modusdb.ErrReadOnlyTxn)
+
+	// a second transaction can share the pinned snapshot
+	txn2, err := ns1.NewReadOnlyTxn(modusdb.AtTimestamp(txn.StartTs()))
+	require.NoError(t, err)
+	_, users, err = modusdb.Query[User](modusdb.ContextWithTxn(ctx, txn2), engine, modusdb.QueryParams{})
+	require.NoError(t, err)
+	require.Len(t, users, 1)
+
+	_, err = ns1.NewReadOnlyTxn(modusdb.AtTimestamp(txn.StartTs() + 1000))
+	require.ErrorIs(t, err, modusdb.ErrSnapshotUnavailable)
+
+	require.NoError(t, txn.Discard(ctx))
+	require.NoError(t, txn2.Discard(ctx))
+	_, err = txn.Query(ctx, `{ me(func: has(name)) { name } }`)
+	require.ErrorIs(t, err, modusdb.ErrTxnFinished)
+
+	// once released, the snapshot may be compacted away
+	_, err = ns1.NewReadOnlyTxn(modusdb.AtTimestamp(txn.StartTs()))
+	require.ErrorIs(t, err, modusdb.ErrSnapshotUnavailable)
+}
+
+func TestConcurrentTypedApi(t *testing.T) {
+	ctx := context.Background()
+	engine, err := modusdb.NewEngine(modusdb.NewDefaultConfig(t.TempDir()))
+	require.NoError(t, err)
+	defer engine.Close()
+
+	ns1, err := engine.CreateNamespace()
+	require.NoError(t, err)
+
+	_, _, err = modusdb.Create(ctx, engine, User{Name: "A", Age: 10, ClerkId: "0"}, ns1.ID())
+	require.NoError(t, err)
+
+	var g errgroup.Group
+	for i := 1; i <= 20; i++ {
+		g.Go(func() error {
+			user := User{Name: fmt.Sprintf("user-%d", i), Age: i, ClerkId: fmt.Sprint(i)}
+			_, _, err := modusdb.Create(ctx, engine, user, ns1.ID())
+			return err
+		})
+		g.Go(func() error {
+			_, users, err := modusdb.Query[User](ctx, engine, modusdb.QueryParams{}, ns1.ID())
+			if err == nil && len(users) == 0 {
+				return fmt.Errorf("expected at least one user")
+			}
+			return err
+		})
+	}
+	require.NoError(t, g.Wait())
+
+	_, users, err := modusdb.Query[User](ctx, engine, modusdb.QueryParams{}, ns1.ID())
+	require.NoError(t, err)
+	require.Len(t, users, 21)
+
+	// concurrent creates with the same unique value conflict with each other
+	errs := make([]error, 2)
+	txns := make([]*modusdb.Txn, 2)
+	for i := range txns {
+		txns[i], err = ns1.NewTxn()
+		require.NoError(t, err)
+		_, _, err = modusdb.Create(modusdb.ContextWithTxn(ctx, txns[i]), engine,
+			User{Name: "dup", ClerkId: "dup"})
+		require.NoError(t, err)
+	}
+	for i, txn := range txns {
+		errs[i] = txn.Commit(ctx)
+	}
+	require.NoError(t, errs[0])
+	require.ErrorIs(t, errs[1], modusdb.ErrTxnAborted)
+}
@@ -0,0 +1,104 @@
+/*
+ * SPDX-FileCopyrightText: © Hypermode Inc. <hello@hypermode.com>
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package unit_test
+
+import (
+	"context"
+	"testing"
+
+	"github.com/dgraph-io/dgo/v240/protos/api"
+	"github.com/stretchr/testify/require"
+
+	"github.com/hypermodeinc/modusdb"
+)
+
+func TestNamespaceUpsert(t *testing.T) {
+	ctx := context.Background()
+	engine, err := modusdb.NewEngine(modusdb.NewDefaultConfig(t.TempDir()))
+	require.NoError(t, err)
+	defer engine.Close()
+
+	ns1, err := engine.CreateNamespace()
+	require.NoError(t, err)
+	require.NoError(t, ns1.AlterSchema(ctx, `
+		email: string @index(exact) @upsert .
+		name: string .
+		balance: int .
+		total: int .
+	`))
+
+	const query = `{
+		q(func: eq(email, "a@example.com")) {
+			v as uid
+		}
+	}`
+	insert := &api.Mutation{
+		Cond:      `@if(eq(len(v), 0))`,
+		SetNquads: []byte(`uid(v) <email> "a@example.com" .` + "\n" + `uid(v) <balance> "10" .`),
+	}
+
+	// the node does not exist, uid(v) is a new node
+	resp, uids, err := ns1.Upsert(ctx, query, []*api.Mutation{insert})
+	require.NoError(t, err)
+	require.JSONEq(t, `{"q":[]}`, string(resp.Json))
+	require.NotZero(t, uids["_:uid(v)"])
+
+	// the condition does not hold anymore, the second mutation uses the UID and value
+	// of the node found
+	const balanceQuery = `{
+		q(func: eq(email, "a@example.com")) {
+			v as uid
+			b as balance
+		}
+	}`
+	resp, uids, err = ns1.Upsert(ctx, balanceQuery, []*api.Mutation{insert, {
+		Cond: `@if(eq(len(v), 1))`,
+		Set: []*api.NQuad{
+			{Subject: "uid(v)", Predicate: "name", ObjectValue: &api.Value{Val: &api.Value_StrVal{StrVal: "A"}}},
+			{Subject: "uid(v)", Predicate: "total", ObjectId: "val(b)"},
+		},
+	}})
+	require.NoError(t, err)
+	require.Empty(t, uids)
+	require.Contains(t, string(resp.Json), `"balance":10`)
+
+	resp, err = ns1.Query(ctx, `{
+		q(func: has(email)) {
+			email
+			name
+			balance
+			total
+		}
+	}`)
+	require.NoError(t, err)
+	require.JSONEq(t, `{"q":[{"email":"a@example.com","name":"A","balance":10,"total":10}]}`,
+		string(resp.Json))
+
+	// deletions with uid(v) are applied to every UID of v
+	_, _, err = ns1.Upsert(ctx, query, []*api.Mutation{{
+		DelNquads: []byte(`uid(v) <name> * .`),
+	}})
+	require.NoError(t, err)
+	resp, err = ns1.Query(ctx, `{ q(func: has(name)) { uid } }`)
+	require.NoError(t, err)
+	require.JSONEq(t, `{"q":[]}`, string(resp.Json))
+
+	// variables must be defined in the query
+	_, _, err = ns1.Upsert(ctx, "", []*api.Mutation{{
+		SetNquads: []byte(`uid(v) <name> "B" .`),
+	}})
+	require.Error(t, err)
+
+	// nothing is applied when the upsert fails
+	_, _, err = ns1.Upsert(ctx, query, []*api.Mutation{
+		{SetNquads: []byte(`uid(v) <name> "C" .`)},
+		{SetNquads: []byte(`uid(v) <balance> "not a number" .`)},
+	})
+	require.Error(t, err)
+	resp, err = ns1.Query(ctx, `{ q(func: has(name)) { uid } }`)
+	require.NoError(t, err)
+	require.JSONEq(t, `{"q":[]}`, string(resp.Json))
+}
@@ -0,0 +1,345 @@
+/*
+ * SPDX-FileCopyrightText: © Hypermode Inc. <hello@hypermode.com>
+ * SPDX-License-Identifier: Apache-2.0
+ */
+
+package modusdb
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/dgraph-io/dgo/v240/protos/api"
+	"github.com/hypermodeinc/dgraph/v24/dql"
+	"github.com/hypermodeinc/dgraph/v24/edgraph"
+	"github.com/hypermodeinc/dgraph/v24/query"
+	"github.com/hypermodeinc/dgraph/v24/types"
+	"github.com/hypermodeinc/dgraph/v24/x"
+	"google.golang.org/protobuf/proto"
+)
+
+// maxUpsertVarUIDs is the maximum number of UIDs of a variable used in the mutations.
+const maxUpsertVarUIDs = 1_000_000
+
+// Upsert runs the query and applies the mutations within the transaction, the same
+// way as a DQL upsert block. The mutations can use the variables defined in the query:
+//   - uid(v), as subject or object, is replaced with each of the UIDs of v, or with a
+//     new node when v has no UIDs.
+//   - val(v), as object, is replaced with the value of v for the subject. N-Quads for
+//     subjects without a value are skipped. A blank node subject gets the value of an
+//     aggregate variable.
+//
+// A mutation with a Cond, e.g. `@if(eq(len(v), 1))`, is only applied if the condition
+// holds. It returns the response of the query and the UIDs assigned to the blank nodes,
+// which include "_:uid(v)" for the variables without UIDs. The latency of the response
+// covers the parsing and processing of both the query and the mutations.
+func (txn *Txn) Upsert(ctx context.Context, q string, ms []*api.Mutation) (*api.Response, map[string]uint64, error) {
+	txn.ns.engine.mutex.RLock()
+	defer txn.ns.engine.mutex.RUnlock()
+	txn.mutex.Lock()
+	defer txn.mutex.Unlock()
+
+	return txn.upsertWithLock(ctx, q, ms)
+}
+
+func (txn *Txn) upsertWithLock(ctx context.Context, q string,
+	ms []*api.Mutation) (*api.Response, map[string]uint64, error) {
+
+	if txn.readOnly {
+		return nil, nil, ErrReadOnlyTxn
+	}
+	if !txn.ns.engine.isOpen.Load() {
+		return nil, nil, ErrClosedEngine
+	}
+	if txn.finished {
+		return nil, nil, ErrTxnFinished
+	}
+	if !txn.ns.engine.z.namespaceExists(txn.ns.ID()) {
+		return nil, nil, ErrNonExistentDB
+	}
+
+	start := time.Now()
+	uc := &upsertContext{
+		uidRes: make(map[string][]string),
+		valRes: make(map[string]map[uint64]types.Val),
+	}
+	for _, mu := range ms {
+		dm, err := edgraph.ParseMutationObject(mu, false)
+		if err != nil {
+			return nil, nil, fmt.Errorf("error parsing mutation: %w", err)
+		}
+		uc.dms = append(uc.dms, dm)
+	}
+	lat := &api.Latency{ParsingNs: uint64(time.Since(start).Nanoseconds())}
+
+	// the variables of the conditions are added by buildUpsertQuery, they are
+	// needed as well
+	upsertQuery := uc.buildUpsertQuery(q)
+	needVars := uc.findMutationVars()
+	resp := &api.Response{Txn: &api.TxnContext{StartTs: txn.startTs}, Latency: lat}
+	if upsertQuery == "" {
+		if len(needVars) > 0 {
+			return nil, nil, fmt.Errorf("variables %v not defined", needVars)
+		}
+		for _, dm := range uc.dms {
+			if strings.TrimSpace(dm.Cond) != "" {
+				return nil, nil, fmt.Errorf("a query is required for conditional mutations")
+			}
+		}
+	} else {
+		ctx := x.AttachNamespace(ctx, txn.ns.ID())
+		var err error
+		resp.Json, err = uc.runQuery(ctx, upsertQuery, needVars, txn.startTs, lat)
+		if err != nil {
+			return nil, nil, err
+		}
+	}
+
+	if err := uc.updateMutations(); err != nil {
+		return nil, nil, err
+	}
+	newUids, err := txn.ns.engine.assignBlankUIDs(ctx, uc.dms)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	numNQuads := 0
+	for _, dm := range uc.dms {
+		numNQuads += len(dm.Set) + len(dm.Del)
+	}
+	if numNQuads > 0 {
+		if err := txn.mutateWithDqlMutation(ctx, uc.dms, newUids); err != nil {
+			return nil, nil, err
+		}
+	}
+	lat.TotalNs = uint64(time.Since(start).Nanoseconds())
+	lat.ProcessingNs = lat.TotalNs - lat.ParsingNs - lat.EncodingNs
+	return resp, newUids, nil
+}
+
+// upsertContext holds the state of an upsert, as done by Dgraph for upsert blocks.
+type upsertContext struct {
+	dms []*dql.Mutation
+	// condVars are the variables added to the query to evaluate the condition of
+	// each mutation, empty for the mutations without a condition
+	condVars []string
+	// uidRes and valRes have the UIDs and values of the variables used in the mutations
+	uidRes map[string][]string
+	valRes map[string]map[uint64]types.Val
+}
+
+// findMutationVars returns the variables used in the mutations.
+func (uc *upsertContext) findMutationVars() []string {
+	updateVars := func(s string) {
+		if strings.HasPrefix(s, "uid(") {
+			uc.uidRes[s[4:len(s)-1]] = nil
+		} else if strings.HasPrefix(s, "val(") {
+			uc.valRes[s[4:len(s)-1]] = nil
+		}
+	}
+	for _, dm := range uc.dms {
+		for _, nq := range dm.Set {
+			updateVars(nq.Subject)
+			updateVars(nq.ObjectId)
+		}
+		for _, nq := range dm.Del {
+			updateVars(nq.Subject)
+			updateVars(nq.ObjectId)
+		}
+	}
+
+	vars := make([]string, 0, len(uc.uidRes)+len(uc.valRes))
+	for v := range uc.uidRes {
+		vars = append(vars, v)
+	}
+	for v := range uc.valRes {
+		vars = append(vars, v)
+	}
+	return vars
+}
+
+// buildUpsertQuery adds a block to the query for the condition of each conditional
+// mutation. The block filters uid(0) with the condition, so its variable has one UID
+// only if the condition holds.
+func (uc *upsertContext) buildUpsertQuery(q string) string {
+	if q == "" || len(uc.dms) == 0 {
+		return q
+	}
+
+	uc.condVars = make([]string, len(uc.dms))
+	var sb strings.Builder
+	sb.WriteString(strings.TrimSuffix(strings.TrimSpace(q), "}"))
+	for i, dm := range uc.dms {
+		if strings.TrimSpace(dm.Cond) == "" {
+			continue
+		}
+		uc.condVars[i] = fmt.Sprintf("__modusdb_upsertcheck_%d__", i)
+		uc.uidRes[uc.condVars[i]] = nil
+		fmt.Fprintf(&sb, "%s as var(func: uid(0)) %s\n",
+			uc.condVars[i], strings.Replace(dm.Cond, "@if", "@filter", 1))
+	}
+	sb.WriteString("}")
+	return sb.String()
+}
+
+// runQuery runs the upsert query and collects the UIDs and values of the variables.
+// The time spent parsing the query and encoding its result is added to lat.
+func (uc *upsertContext) runQuery(ctx context.Context, q string, needVars []string, readTs uint64,
+	lat *api.Latency) ([]byte, error) {
+
+	start := time.Now()
+	res, err := dql.ParseWithNeedVars(dql.Request{Str: q}, needVars)
+	if err != nil {
+		return nil, fmt.Errorf("error parsing query: %w", err)
+	}
+	if res.Schema != nil {
+		return nil, fmt.Errorf("schema queries are not allowed in an upsert")
+	}
+
+	lat.ParsingNs += uint64(time.Since(start).Nanoseconds())
+
+	qr := query.Request{
+		ReadTs:   readTs,
+		Latency:  &query.Latency{Start: time.Now()},
+		DqlQuery: &res,
+	}
+	er, err := qr.Process(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("error processing query: %w", err)
+	}
+	start = time.Now()
+	out, err := query.ToJson(ctx, qr.Latency, er.Subgraphs, nil)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding query result: %w", err)
+	}
+	lat.EncodingNs = uint64(time.Since(start).Nanoseconds())
+
+	for name := range uc.uidRes {
+		v := qr.Vars[name]
+		var uids []uint64
+		if v.Uids != nil && len(v.Uids.Uids) > 0 {
+			uids = v.Uids.Uids
+		} else {
+			for uid := range v.Vals {
+				uids = append(uids, uid)
+			}
+		}
+		if len(uids) > maxUpsertVarUIDs {
+			return nil, fmt.Errorf("variable [%v] has more than %d UIDs", name, maxUpsertVarUIDs)
+		}
+		if len(uids) == 0 {
+			continue
+		}
+		uc.uidRes[name] = make([]string, len(uids))
+		for i, uid := range uids {
+			uc.uidRes[name][i] = fmt.Sprintf("%#x", uid)
+		}
+	}
+	for name := range uc.valRes {
+		uc.valRes[name] = qr.Vars[name].Vals
+	}
+	return out, nil
+}
+
+// updateMutations drops the mutations whose condition does not hold and replaces
+// the variables in the others with their UIDs and values.
+func (uc *upsertContext) updateMutations() error {
+	for i, dm := range uc.dms {
+		if i < len(uc.condVars) && uc.condVars[i] != "" && len(uc.uidRes[uc.condVars[i]]) != 1 {
+			dm.Set = nil
+			dm.Del = nil
+			continue
+		}
+		uc.updateUIDs(dm)
+		if err := uc.updateVals(dm); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// updateUIDs replaces uid(v) with the UIDs of v, an N-Quad is repeated for every
+// combination of the UIDs of its subject and object. Variables without UIDs become
+// blank nodes in the N-Quads set and drop the N-Quads deleted.
+func (uc *upsertContext) updateUIDs(dm *dql.Mutation) {
+	newVals := func(s string) []string {
+		if strings.HasPrefix(s, "uid(") {
+			if uids := uc.uidRes[s[4:len(s)-1]]; len(uids) > 0 {
+				return uids
+			}
+			return []string{"_:" + s}
+		}
+		return []string{s}
+	}
+	expand := func(nqs []*api.NQuad, isSet bool) []*api.NQuad {
+		out := make([]*api.NQuad, 0, len(nqs))
+		for _, nq := range nqs {
+			for _, s := range newVals(nq.Subject) {
+				for _, o := range newVals(nq.ObjectId) {
+					if !isSet && (strings.HasPrefix(s, "_:uid(") || strings.HasPrefix(o, "_:uid(")) {
+						continue
+					}
+					n := proto.Clone(nq).(*api.NQuad)
+					n.Subject = s
+					n.ObjectId = o
+					out = append(out, n)
+				}
+			}
+		}
+		return out
+	}
+	dm.Del = expand(dm.Del, false)
+	dm.Set = expand(dm.Set, true)
+}
+
+// updateVals replaces val(v) in the objects with the value of v for the subject.
+func (uc *upsertContext) updateVals(dm *dql.Mutation) error {
+	update := func(nqs []*api.NQuad, isSet bool) ([]*api.NQuad, error) {
+		out := nqs[:0]
+		for _, nq := range nqs {
+			if !strings.HasPrefix(nq.ObjectId, "val(") {
+				out = append(out, nq)
+				continue
+			}
+			vals := uc.valRes[nq.ObjectId[4:len(nq.ObjectId)-1]]
+
+			var subject uint64
+			if strings.HasPrefix(nq.Subject, "_:") {
+				// only the value of an aggregate variable, kept at 0, applies to new nodes
+				if !isSet {
+					continue
+				}
+			} else {
+				var err error
+				if subject, err = strconv.ParseUint(nq.Subject, 0, 64); err != nil {
+					return nil, fmt.Errorf("error parsing subject [%v]: %w", nq.Subject, err)
+				}
+			}
+			val, ok := vals[subject]
+			if !ok {
+				if val, ok = vals[0]; !ok {
+					continue
+				}
+			}
+
+			ov, err := types.ObjectValue(val.Tid, val.Value)
+			if err != nil {
+				return nil, fmt.Errorf("error converting value of [%v]: %w", nq.ObjectId, err)
+			}
+			nq.ObjectId = ""
+			nq.ObjectValue = ov
+			out = append(out, nq)
+		}
+		return out, nil
+	}
+
+	var err error
+	if dm.Del, err = update(dm.Del, false); err != nil {
+		return err
+	}
+	dm.Set, err = update(dm.Set, true)
+	return err
+}
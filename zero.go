@@ -6,7 +6,9 @@
 package modusdb
 
 import (
+	"encoding/json"
 	"fmt"
+	"sync"
 
 	"github.com/dgraph-io/badger/v4"
 	"github.com/hypermodeinc/dgraph/v24/posting"
@@ -27,7 +29,8 @@ const (
 	leaseUIDAtATime = 10000
 	leaseTsAtATime  = 10000
 
-	zeroStateKey = "0-dgraph.modusdb.zero"
+	zeroStateKey  = "0-dgraph.modusdb.zero"
+	namespacesKey = "0-dgraph.modusdb.namespaces"
 )
 
 func (ns *Engine) LeaseUIDs(numUIDs uint64) (*pb.AssignedIds, error) {
@@ -35,7 +38,10 @@ func (ns *Engine) LeaseUIDs(numUIDs uint64) (*pb.AssignedIds, error) {
 	return ns.z.nextUIDs(num)
 }
 
+// zero leases the UIDs, timestamps and namespace IDs, it is safe for concurrent use.
 type zero struct {
+	sync.Mutex
+
 	minLeasedUID uint64
 	maxLeasedUID uint64
 
@@ -43,6 +49,19 @@ type zero struct {
 	maxLeasedTs uint64
 
 	lastNamespace uint64
+
+	// namespaces holds the metadata of the namespaces, it is persisted next to
+	// the zero state. Namespaces without any metadata are not present.
+	namespaces map[uint64]*namespaceMeta
+}
+
+type namespaceMeta struct {
+	Name    string            `json:"name,omitempty"`
+	Labels  map[string]string `json:"labels,omitempty"`
+	Deleted bool              `json:"deleted,omitempty"`
+	// DroppedTs is the timestamp of the last drop of data, predicates or types in
+	// the namespace, which incremental backups cannot record.
+	DroppedTs uint64 `json:"dropped_ts,omitempty"`
 }
 
 func newZero() (*zero, bool, error) {
@@ -66,6 +85,11 @@ func newZero() (*zero, bool, error) {
 		z.maxLeasedTs = zs.MaxTxnTs
 		z.lastNamespace = zs.MaxNsID
 	}
+	z.namespaces, err = readNamespaces()
+	if err != nil {
+		return nil, false, err
+	}
+
 	posting.Oracle().ProcessDelta(&pb.OracleDelta{MaxAssigned: z.minLeasedTs - 1})
 	worker.SetMaxUID(z.minLeasedUID - 1)
 
@@ -80,6 +104,9 @@ func newZero() (*zero, bool, error) {
 }
 
 func (z *zero) nextTs() (uint64, error) {
+	z.Lock()
+	defer z.Unlock()
+
 	if z.minLeasedTs >= z.maxLeasedTs {
 		if err := z.leaseTs(); err != nil {
 			return 0, fmt.Errorf("error leasing timestamps: %w", err)
@@ -93,6 +120,8 @@ func (z *zero) nextTs() (uint64, error) {
 }
 
 func (z *zero) readTs() uint64 {
+	z.Lock()
+	defer z.Unlock()
 	return z.minLeasedTs - 1
 }
 
@@ -105,6 +134,9 @@ func (z *zero) nextUID() (uint64, error) {
 }
 
 func (z *zero) nextUIDs(num *pb.Num) (*pb.AssignedIds, error) {
+	z.Lock()
+	defer z.Unlock()
+
 	var resp *pb.AssignedIds
 	if num.Bump {
 		if z.minLeasedUID >= num.Val {
@@ -129,14 +161,224 @@ func (z *zero) nextUIDs(num *pb.Num) (*pb.AssignedIds, error) {
 	return resp, nil
 }
 
-func (z *zero) nextNamespace() (uint64, error) {
+func (z *zero) nextNamespace(meta *namespaceMeta) (uint64, error) {
+	z.Lock()
+	defer z.Unlock()
+
+	if meta.Name != "" {
+		if _, ok := z.namespaceByNameWithLock(meta.Name); ok {
+			return 0, ErrNamespaceNameExists
+		}
+	}
+
 	z.lastNamespace++
 	if err := z.writeZeroState(); err != nil {
+		z.lastNamespace--
 		return 0, fmt.Errorf("error leasing namespace ID: %w", err)
 	}
+
+	if meta.Name == "" && len(meta.Labels) == 0 {
+		return z.lastNamespace, nil
+	}
+	// the ID stays leased on error, but the name is only reserved once it is stored
+	z.namespaces[z.lastNamespace] = meta
+	if err := writeNamespaces(z.namespaces); err != nil {
+		delete(z.namespaces, z.lastNamespace)
+		return 0, fmt.Errorf("error storing namespace metadata: %w", err)
+	}
 	return z.lastNamespace, nil
 }
 
+// namespaceByName returns the ID of the live namespace with the given name.
+func (z *zero) namespaceByName(name string) (uint64, bool) {
+	z.Lock()
+	defer z.Unlock()
+	return z.namespaceByNameWithLock(name)
+}
+
+func (z *zero) namespaceByNameWithLock(name string) (uint64, bool) {
+	for nsID, meta := range z.namespaces {
+		if !meta.Deleted && meta.Name == name {
+			return nsID, true
+		}
+	}
+	return 0, false
+}
+
+// namespaceMetadata returns a copy of the metadata of the namespace.
+func (z *zero) namespaceMetadata(nsID uint64) namespaceMeta {
+	z.Lock()
+	defer z.Unlock()
+
+	meta, ok := z.namespaces[nsID]
+	if !ok {
+		return namespaceMeta{}
+	}
+	labels := make(map[string]string, len(meta.Labels))
+	for k, v := range meta.Labels {
+		labels[k] = v
+	}
+	return namespaceMeta{Name: meta.Name, Labels: labels, Deleted: meta.Deleted, DroppedTs: meta.DroppedTs}
+}
+
+func (z *zero) renameNamespace(nsID uint64, name string) error {
+	z.Lock()
+	defer z.Unlock()
+
+	if otherID, ok := z.namespaceByNameWithLock(name); ok {
+		if otherID == nsID {
+			return nil
+		}
+		return ErrNamespaceNameExists
+	}
+
+	meta, ok := z.namespaces[nsID]
+	if !ok {
+		meta = &namespaceMeta{}
+		z.namespaces[nsID] = meta
+	}
+	oldName := meta.Name
+	meta.Name = name
+	if err := writeNamespaces(z.namespaces); err != nil {
+		meta.Name = oldName
+		return fmt.Errorf("error renaming namespace: %w", err)
+	}
+	return nil
+}
+
+// namespaceExists returns whether the namespace was created and has not been deleted.
+func (z *zero) namespaceExists(nsID uint64) bool {
+	z.Lock()
+	defer z.Unlock()
+	return nsID <= z.lastNamespace && !z.namespaces[nsID].isDeleted()
+}
+
+// liveNamespaces returns the IDs of the namespaces that have not been deleted, in order.
+func (z *zero) liveNamespaces() []uint64 {
+	z.Lock()
+	defer z.Unlock()
+
+	nsIDs := make([]uint64, 0, z.lastNamespace+1)
+	for nsID := uint64(0); nsID <= z.lastNamespace; nsID++ {
+		if !z.namespaces[nsID].isDeleted() {
+			nsIDs = append(nsIDs, nsID)
+		}
+	}
+	return nsIDs
+}
+
+func (z *zero) deleteNamespace(nsID uint64) error {
+	z.Lock()
+	defer z.Unlock()
+
+	meta, ok := z.namespaces[nsID]
+	if !ok {
+		meta = &namespaceMeta{}
+		z.namespaces[nsID] = meta
+	}
+	meta.Deleted = true
+	if err := writeNamespaces(z.namespaces); err != nil {
+		return fmt.Errorf("error deleting namespace: %w", err)
+	}
+	return nil
+}
+
+// recordDrop records a drop in the namespaces at the timestamp.
+func (z *zero) recordDrop(ts uint64, nsIDs ...uint64) error {
+	z.Lock()
+	defer z.Unlock()
+
+	for _, nsID := range nsIDs {
+		meta, ok := z.namespaces[nsID]
+		if !ok {
+			meta = &namespaceMeta{}
+			z.namespaces[nsID] = meta
+		}
+		meta.DroppedTs = max(meta.DroppedTs, ts)
+	}
+	if err := writeNamespaces(z.namespaces); err != nil {
+		return fmt.Errorf("error recording drop: %w", err)
+	}
+	return nil
+}
+
+// droppedSince returns whether there was a drop after sinceTs in the namespaces for
+// which include returns true.
+func (z *zero) droppedSince(sinceTs uint64, include func(nsID uint64) bool) bool {
+	z.Lock()
+	defer z.Unlock()
+
+	for nsID, meta := range z.namespaces {
+		if include(nsID) && meta.DroppedTs > sinceTs {
+			return true
+		}
+	}
+	return false
+}
+
+func (m *namespaceMeta) isDeleted() bool {
+	return m != nil && m.Deleted
+}
+
+// snapshot returns the zero state along with the metadata of the namespaces
+// for which include returns true.
+func (z *zero) snapshot(include func(nsID uint64) bool) (*pb.MembershipState, map[uint64]*namespaceMeta) {
+	z.Lock()
+	defer z.Unlock()
+
+	namespaces := make(map[uint64]*namespaceMeta)
+	for nsID, meta := range z.namespaces {
+		if include(nsID) {
+			namespaces[nsID] = meta
+		}
+	}
+	return &pb.MembershipState{MaxUID: z.maxLeasedUID, MaxTxnTs: z.maxLeasedTs, MaxNsID: z.lastNamespace}, namespaces
+}
+
+// restore moves the leases past the ones in the restored zero state, so that no UID or
+// timestamp in the restored data gets leased again. The metadata of the namespaces for
+// which restored returns true is replaced by the restored metadata. Both are persisted.
+func (z *zero) restore(zs *pb.MembershipState, namespaces map[uint64]*namespaceMeta,
+	restored func(nsID uint64) bool) error {
+	z.Lock()
+	defer z.Unlock()
+
+	if zs != nil {
+		z.minLeasedUID = max(z.minLeasedUID, zs.MaxUID)
+		z.maxLeasedUID = max(z.maxLeasedUID, zs.MaxUID)
+		z.minLeasedTs = max(z.minLeasedTs, zs.MaxTxnTs)
+		z.maxLeasedTs = max(z.maxLeasedTs, zs.MaxTxnTs)
+		z.lastNamespace = max(z.lastNamespace, zs.MaxNsID)
+	}
+	for nsID := range z.namespaces {
+		if restored(nsID) {
+			delete(z.namespaces, nsID)
+		}
+	}
+	for nsID, meta := range namespaces {
+		if restored(nsID) {
+			z.namespaces[nsID] = meta
+		}
+	}
+
+	return z.writeStateWithLock()
+}
+
+// writeState persists the zero state and the namespace metadata again,
+// e.g. after they were removed by dropping the data of the default namespace.
+func (z *zero) writeState() error {
+	z.Lock()
+	defer z.Unlock()
+	return z.writeStateWithLock()
+}
+
+func (z *zero) writeStateWithLock() error {
+	if err := z.writeZeroState(); err != nil {
+		return err
+	}
+	return writeNamespaces(z.namespaces)
+}
+
 func readZeroState() (*pb.MembershipState, error) {
 	txn := worker.State.Pstore.NewTransactionAt(zeroStateTs, false)
 	defer txn.Discard()
@@ -160,6 +402,53 @@ func readZeroState() (*pb.MembershipState, error) {
 	return zeroState, nil
 }
 
+func readNamespaces() (map[uint64]*namespaceMeta, error) {
+	txn := worker.State.Pstore.NewTransactionAt(zeroStateTs, false)
+	defer txn.Discard()
+
+	namespaces := make(map[uint64]*namespaceMeta)
+	item, err := txn.Get(x.DataKey(namespacesKey, zeroStateUID))
+	if err != nil {
+		if err == badger.ErrKeyNotFound {
+			return namespaces, nil
+		}
+		return nil, fmt.Errorf("error getting namespaces: %v", err)
+	}
+
+	err = item.Value(func(val []byte) error {
+		return json.Unmarshal(val, &namespaces)
+	})
+	if err != nil {
+		return nil, fmt.Errorf("error unmarshalling namespaces: %v", err)
+	}
+
+	return namespaces, nil
+}
+
+func writeNamespaces(namespaces map[uint64]*namespaceMeta) error {
+	data, err := json.Marshal(namespaces)
+	if err != nil {
+		return fmt.Errorf("error marshalling namespaces: %w", err)
+	}
+
+	txn := worker.State.Pstore.NewTransactionAt(zeroStateTs, true)
+	defer txn.Discard()
+
+	e := &badger.Entry{
+		Key:      x.DataKey(namespacesKey, zeroStateUID),
+		Value:    data,
+		UserMeta: posting.BitCompletePosting,
+	}
+	if err := txn.SetEntry(e); err != nil {
+		return fmt.Errorf("error setting namespaces: %w", err)
+	}
+	if err := txn.CommitAt(zeroStateTs, nil); err != nil {
+		return fmt.Errorf("error committing namespaces: %w", err)
+	}
+
+	return nil
+}
+
 func (z *zero) writeZeroState() error {
 	zeroState := &pb.MembershipState{MaxUID: z.maxLeasedUID, MaxTxnTs: z.maxLeasedTs, MaxNsID: z.lastNamespace}
 	data, err := proto.Marshal(zeroState)